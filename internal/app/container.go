@@ -1,17 +1,31 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
-	"k8s.io/client-go/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
 
 	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/health"
 	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
 	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	kubecache "github.com/omissis/kube-apiserver-proxy/pkg/kube/cache"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+	"github.com/omissis/kube-apiserver-proxy/pkg/ratelimit"
+	"github.com/omissis/kube-apiserver-proxy/pkg/tracing"
 )
 
 var ErrCannotCreateContainer = fmt.Errorf("cannot create container")
@@ -24,70 +38,172 @@ type ContainerFactoryFunc func() (*Container, error)
 
 func NewDefaultParameters() Parameters {
 	return Parameters{
-		APIServerTimeout:  5 * time.Second,
-		APIServerHost:     "0.0.0.0",
-		APIServerPort:     apiServerPort,
-		APIAllowedOrigins: []string{"http://localhost:3000", "http://kasp.dev"},
-		Config:            config.Config{},
+		APIServerTimeout:    5 * time.Second,
+		APIServerHost:       "0.0.0.0",
+		APIServerPort:       apiServerPort,
+		APIAllowedOrigins:   []string{"http://localhost:3000", "http://kasp.dev"},
+		MetricsAddress:      "0.0.0.0:9090",
+		HealthPathPrefix:    "/kasp",
+		ReadinessTimeout:    3 * time.Second,
+		ShutdownGracePeriod: 30 * time.Second,
+		Config:              config.Config{},
 	}
 }
 
 type Parameters struct {
-	APIServerTimeout  time.Duration
-	APIServerHost     string
-	APIServerPort     uint16
-	APIAllowedOrigins []string
-	Config            config.Config
-	KubeconfigPath    string
+	APIServerTimeout    time.Duration
+	APIServerHost       string
+	APIServerPort       uint16
+	APIAllowedOrigins   []string
+	MetricsAddress      string
+	TracingEndpoint     string
+	HealthAddress       string
+	HealthPathPrefix    string
+	ReadinessTimeout    time.Duration
+	ShutdownDelay       time.Duration
+	ShutdownGracePeriod time.Duration
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSClientCAFile     string
+	Config              config.Config
+	KubeconfigPath      string
 }
 
 type services struct {
 	httpServer           *http.Server
 	httpServeMux         *httpx.ServeMux
-	k8sRESTClientFactory *kube.DefaultRESTClientFactory
+	k8sRESTClientFactory kube.RESTClientFactory
+	k8sClusters          *kube.MultiClusterRESTClientFactory
 	k8sHTTProxy          *proxy.HTTP
-	k8sHTTPClient        *http.Client
+	readCache            proxy.ReadCache
+	stopReadCache        context.CancelFunc
 	k8sRESTConfigFactory *kube.DefaultRESTConfigFactory
+	certificates         *httpx.CertificateReloader
+	clientCAs            *httpx.CertPoolReloader
+	rateLimiter          *ratelimit.Limiter
+	rateLimitRules       []config.RateLimitRule
+	handler              *httpx.SwappableHandler
+	healthHandler        *httpx.SwappableHandler
+	healthServer         *http.Server
+	metrics              *metrics.Metrics
+	metricsRegistry      *prometheus.Registry
+	metricsServer        *http.Server
+	tracerProvider       trace.TracerProvider
 }
 
 func NewContainer() *Container {
 	return &Container{
 		Parameters: NewDefaultParameters(),
+		notReady:   make(chan struct{}),
+		drain:      make(chan struct{}),
 	}
 }
 
 type Container struct {
 	Parameters
 	services
+
+	// mu serializes config reloads with the other goroutines reading the config or the services built from it.
+	mu       sync.Mutex
+	reloaded chan struct{}
+
+	// notReady and drain are closed, in this order, when the container shuts down.
+	notReady     chan struct{}
+	drain        chan struct{}
+	shutdownOnce sync.Once
 }
 
 func (c *Container) HTTPServeMux() *httpx.ServeMux {
 	if c.httpServeMux == nil {
 		c.httpServeMux = httpx.NewServeMux(nil)
 
-		if len(c.Parameters.APIAllowedOrigins) > 0 {
-			c.httpServeMux.Use(
-				middleware.CORSMux(middleware.CORSConfig{
-					AllowOrigins: c.Parameters.APIAllowedOrigins,
-				}),
-			)
-		}
-
 		if c.Parameters.Config.Middlewares.BodyFilter.Enabled {
-			c.httpServeMux.Use(middleware.BodyFilterMux(
+			c.httpServeMux.Use(c.traced("bodyFilter", middleware.BodyFilterMux(
 				c.Parameters.Config.Middlewares.BodyFilter.Config,
+			)))
+		}
+
+		// Authorization is added before Authentication, so that it runs after it and sees the caller identity.
+		if c.Parameters.Config.Middlewares.Authorization.Enabled {
+			c.httpServeMux.Use(c.traced("authorization", middleware.AuthorizationMux(
+				c.Parameters.Config.Middlewares.Authorization.Config,
+			)))
+		}
+
+		// RateLimit runs after Authentication, to key the buckets on the caller identity, and before Authorization,
+		// so that denied requests are limited too.
+		if c.Parameters.Config.Middlewares.RateLimit.Enabled {
+			limiter := c.RateLimiter()
+
+			c.httpServeMux.Use(c.traced("rateLimit", func(next http.Handler) http.Handler {
+				return middleware.RateLimit(next, limiter)
+			}))
+		}
+
+		if c.Parameters.Config.Middlewares.Authentication.Enabled {
+			c.httpServeMux.Use(c.traced("authentication", middleware.AuthenticationMux(
+				c.Parameters.Config.Middlewares.Authentication.Config,
+				c.Parameters.Config.Passthrough.Enabled,
+			)))
+		}
+
+		// ClientCertificate is added after Authentication, so that it runs before it: bearer tokens win.
+		if c.Parameters.TLSClientCAFile != "" {
+			c.httpServeMux.Use(c.traced("clientCertificate", middleware.ClientCertificateMux()))
+		}
+
+		c.httpServeMux.Use(c.traced("metrics", middleware.MetricsMux(c.Metrics())))
+
+		c.httpServeMux.Use(c.traced("accessLog", middleware.AccessLogMux(slog.Default())))
+
+		// RequestInfo runs before all the other middlewares, so that they can share the parsed request.
+		c.httpServeMux.Use(c.traced("requestInfo", middleware.RequestInfoMux()))
+
+		// ClusterRouting strips the cluster prefix before anything else looks at the request path.
+		if len(c.Parameters.Config.Clusters.List) > 0 {
+			c.httpServeMux.Use(c.traced(
+				"clusterRouting",
+				middleware.ClusterRoutingMux(c.Parameters.Config.Clusters.Header),
 			))
 		}
+
+		// CORS wraps all the other middlewares, so that it answers the preflight requests before they are
+		// authenticated, and so that the errors returned by the others carry the CORS headers too.
+		if len(c.Parameters.APIAllowedOrigins) > 0 {
+			c.httpServeMux.Use(c.traced("cors", middleware.CORSMux(middleware.CORSConfig{
+				AllowOrigins: c.Parameters.APIAllowedOrigins,
+			})))
+		}
+
+		// Tracing is the outermost middleware, so that the spans of all the others belong to the request one.
+		c.httpServeMux.Use(middleware.TracingMux(c.TracerProvider()))
 	}
 
 	return c.httpServeMux
 }
 
+// RateLimiter returns the limiter of the rate limit rules. It is kept across the config reloads that leave
+// the rules unchanged, so that reloading the config does not refill the buckets of the callers.
+func (c *Container) RateLimiter() *ratelimit.Limiter {
+	rules := c.Config.Middlewares.RateLimit.Config
+
+	if c.rateLimiter == nil || !reflect.DeepEqual(c.rateLimitRules, rules) {
+		c.rateLimiter = ratelimit.NewLimiter(rules)
+		c.rateLimitRules = rules
+	}
+
+	return c.rateLimiter
+}
+
+func (c *Container) traced(name string, mw httpx.MuxMiddleware) httpx.MuxMiddleware {
+	return middleware.Traced(c.TracerProvider(), name, mw)
+}
+
 func (c *Container) HTTPServer() *http.Server {
 	if c.httpServer == nil {
 		c.httpServer = &http.Server{
 			Addr:              fmt.Sprintf("%s:%d", c.APIServerHost, c.APIServerPort),
-			Handler:           c.HTTPServeMux(),
+			Handler:           c.Handler(),
 			ReadHeaderTimeout: c.APIServerTimeout,
 		}
 	}
@@ -95,54 +211,374 @@ func (c *Container) HTTPServer() *http.Server {
 	return c.httpServer
 }
 
+// MetricsServer serves the metrics on their own listener, so that they are not exposed along with the proxy.
+func (c *Container) MetricsServer() *http.Server {
+	if c.metricsServer == nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(c.MetricsRegistry(), promhttp.HandlerOpts{}))
+
+		c.metricsServer = &http.Server{
+			Addr:              c.MetricsAddress,
+			Handler:           mux,
+			ReadHeaderTimeout: c.APIServerTimeout,
+		}
+	}
+
+	return c.metricsServer
+}
+
+// HealthServer serves the probes on their own listener, when HealthAddress is set.
+func (c *Container) HealthServer() *http.Server {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.healthServer == nil {
+		c.healthHandler = httpx.NewSwappableHandler(c.healthRoutes())
+
+		c.healthServer = &http.Server{
+			Addr:              c.HealthAddress,
+			Handler:           c.healthHandler,
+			ReadHeaderTimeout: c.APIServerTimeout,
+		}
+	}
+
+	return c.healthServer
+}
+
+func (c *Container) healthRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	c.registerHealthRoutes(mux)
+
+	return mux
+}
+
+// registerHealthRoutes adds the /livez and /readyz endpoints, under HealthPathPrefix, to the given mux.
+func (c *Container) registerHealthRoutes(mux *http.ServeMux) {
+	prefix := strings.Trim(c.HealthPathPrefix, "/")
+	if prefix != "" {
+		prefix = "/" + prefix
+	}
+
+	mux.Handle(prefix+"/livez", health.NewHandler("livez", 0, health.Ping))
+	mux.Handle(prefix+"/readyz", health.NewHandler("readyz", c.ReadinessTimeout, c.readinessChecks()...))
+}
+
+// readinessChecks checks that the proxy is not shutting down, and the apiserver of every configured cluster,
+// or the only one when there are none.
+func (c *Container) readinessChecks() []health.Check {
+	shutdown := health.NewCheck("shutdown", func(context.Context) error {
+		select {
+		case <-c.notReady:
+			return ErrShuttingDown
+		default:
+			return nil
+		}
+	})
+
+	if len(c.Config.Clusters.List) == 0 {
+		f := c.RESTClientFactory()
+
+		return []health.Check{
+			shutdown,
+			health.NewCheck("apiserver", func(ctx context.Context) error {
+				return kube.CheckReadyz(ctx, f)
+			}),
+		}
+	}
+
+	clusters := c.MultiClusterRESTClientFactory()
+	checks := make([]health.Check, 0, len(c.Config.Clusters.List)+1)
+	checks = append(checks, shutdown)
+
+	for _, name := range clusters.Clusters() {
+		name := name
+
+		checks = append(checks, health.NewCheck("apiserver/"+name, func(ctx context.Context) error {
+			f, err := clusters.ClusterFactory(name)
+			if err != nil {
+				return err
+			}
+
+			return kube.CheckReadyz(ctx, f)
+		}))
+	}
+
+	return checks
+}
+
+// TracerProvider exports the spans to the OTLP collector at TracingEndpoint, if any. It is created once and
+// kept across config reloads. An invalid endpoint is logged and leaves tracing disabled, rather than failing.
+func (c *Container) TracerProvider() trace.TracerProvider {
+	if c.tracerProvider == nil {
+		c.tracerProvider = trace.NewNoopTracerProvider()
+
+		if c.TracingEndpoint != "" {
+			tp, err := tracing.NewOTLPTracerProvider(context.Background(), c.TracingEndpoint)
+			if err != nil {
+				slog.Error("cannot create tracer provider, tracing is disabled", "error", err)
+			} else {
+				c.tracerProvider = tp
+			}
+		}
+	}
+
+	return c.tracerProvider
+}
+
+// ShutdownTracing flushes the spans not exported yet.
+func (c *Container) ShutdownTracing(ctx context.Context) error {
+	if tp, ok := c.tracerProvider.(*sdktrace.TracerProvider); ok {
+		if err := tp.Shutdown(ctx); err != nil {
+			return fmt.Errorf("cannot shut tracer provider down: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Metrics are created once and kept across config reloads, so that counters are not reset.
+func (c *Container) Metrics() *metrics.Metrics {
+	if c.metrics == nil {
+		c.metrics = metrics.New(c.MetricsRegistry())
+	}
+
+	return c.metrics
+}
+
+func (c *Container) MetricsRegistry() *prometheus.Registry {
+	if c.metricsRegistry == nil {
+		c.metricsRegistry = prometheus.NewRegistry()
+		c.metricsRegistry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+
+		metrics.RegisterClientCacheSize(c.metricsRegistry, c.clientCacheSize)
+	}
+
+	return c.metricsRegistry
+}
+
+func (c *Container) clientCacheSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.k8sRESTClientFactory.(kube.CacheSizer); ok {
+		return s.CacheSize()
+	}
+
+	return 0
+}
+
+// Handler returns the handler serving all the routes of the proxy, which is swapped on config reloads.
+func (c *Container) Handler() *httpx.SwappableHandler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.handler == nil {
+		c.handler = httpx.NewSwappableHandler(c.routes())
+	}
+
+	return c.handler
+}
+
+func (c *Container) routes() http.Handler {
+	mux := c.HTTPServeMux()
+
+	if len(c.Config.Clusters.List) > 0 {
+		mux.Handle("/clusters", c.ClustersHandler())
+	}
+
+	// The probes are registered on the underlying mux, as they must not go through the middlewares:
+	// the kubelet can neither authenticate nor be authorized.
+	if c.HealthAddress == "" {
+		c.registerHealthRoutes(mux.ServeMux)
+	}
+
+	p := c.K8sHTTPProxy()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			http.Error(w, "request is empty", http.StatusInternalServerError)
+
+			return
+		}
+
+		if w == nil {
+			http.Error(w, "response is empty", http.StatusInternalServerError)
+
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		if err := p.DoServeHTTP(ctx, w, *r); err != nil {
+			slog.Error("cannot proxy request", "error", err, "path", r.URL.Path)
+
+			proxy.WriteError(w, err)
+		}
+	})
+
+	return mux
+}
+
 func (c *Container) K8sHTTPProxy() *proxy.HTTP {
 	if c.k8sHTTProxy == nil {
-		c.k8sHTTProxy = proxy.NewHTTP(c.RESTClientFactory(), []proxy.ResponseBodyTransformer{
-			proxy.NewJqResponseBodyTransformer(),
-		})
+		c.k8sHTTProxy = proxy.NewHTTP(
+			c.RESTClientFactory(),
+			[]proxy.ResponseBodyTransformer{
+				proxy.NewJqResponseBodyTransformer(),
+				proxy.NewJSONPathResponseBodyTransformer(),
+				proxy.NewCELResponseBodyTransformer(),
+				proxy.NewCELFilterResponseBodyTransformer(),
+				proxy.NewGoTemplateResponseBodyTransformer(),
+			},
+			proxy.WithResponseHeaderPolicy(httpx.NewResponseHeaderPolicy(c.Config.Headers.Response)),
+			proxy.WithTracerProvider(c.TracerProvider()),
+			proxy.WithDrain(c.drain),
+			proxy.WithReadCache(c.ReadCache()),
+			proxy.WithTransforms(c.Config.Transforms),
+		)
 	}
 
 	return c.k8sHTTProxy
 }
 
-func (c *Container) RESTClientFactory() *kube.DefaultRESTClientFactory {
-	if c.k8sRESTClientFactory == nil {
-		c.k8sRESTClientFactory = kube.NewDefaultRESTClientFactory(
-			c.RESTConfigFactory(),
-			c.K8sHTTPClient(),
-			c.KubeconfigPath,
-		)
+// ReadCache starts the informers of the resources to cache, in every cluster: they run until StopReadCache
+// is called, which happens on config reloads. It returns nil when the cache is disabled.
+func (c *Container) ReadCache() proxy.ReadCache {
+	if !c.Config.Cache.Enabled {
+		return nil
 	}
 
-	return c.k8sRESTClientFactory
+	if c.readCache != nil {
+		return c.readCache
+	}
+
+	if len(c.Config.Clusters.List) == 0 {
+		rc := c.newReadCache(c.RESTConfigFactory(), "")
+		if rc == nil {
+			return nil
+		}
+
+		c.startReadCache(rc)
+
+		return c.readCache
+	}
+
+	caches := make(map[string]*kubecache.Cache, len(c.Config.Clusters.List))
+
+	for _, cluster := range c.Config.Clusters.List {
+		if rc := c.newReadCache(kube.NewClusterRESTConfigFactory(cluster), cluster.Name); rc != nil {
+			caches[cluster.Name] = rc
+		}
+	}
+
+	c.startReadCache(kubecache.NewClusters(caches, c.Config.Clusters.Default))
+
+	return c.readCache
 }
 
-func (c *Container) RESTConfigFactory() *kube.DefaultRESTConfigFactory {
-	if c.k8sRESTConfigFactory == nil {
-		c.k8sRESTConfigFactory = kube.NewDefaultRESTConfigFactory()
+// newReadCache creates the cache of a cluster, logging the failures: the requests of a cluster without
+// a cache are all sent to its apiserver.
+func (c *Container) newReadCache(f kube.RESTConfigFactory, cluster string) *kubecache.Cache {
+	restConfig, err := f.New(c.KubeconfigPath)
+	if err != nil {
+		slog.Error("cannot create rest config, the cache is disabled", "error", err, "cluster", cluster)
+
+		return nil
 	}
 
-	return c.k8sRESTConfigFactory
+	rc, err := kubecache.New(restConfig, c.Config.Cache.Resources)
+	if err != nil {
+		slog.Error("cannot create cache, the cache is disabled", "error", err, "cluster", cluster)
+
+		return nil
+	}
+
+	return rc
+}
+
+// startableReadCache is implemented by the caches of a single cluster and of all of them.
+type startableReadCache interface {
+	proxy.ReadCache
+	Start(ctx context.Context)
 }
 
-func (c *Container) K8sHTTPClient() *http.Client {
-	if c.k8sHTTPClient == nil {
-		k8sHTTPClient, err := rest.HTTPClientFor(c.K8sRestConfig())
-		if err != nil {
-			panic(err)
+func (c *Container) startReadCache(rc startableReadCache) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	rc.Start(ctx)
+
+	c.readCache = rc
+	c.stopReadCache = cancel
+}
+
+// StopReadCache stops the informers of the cache, if any.
+func (c *Container) StopReadCache() {
+	if c.stopReadCache != nil {
+		c.stopReadCache()
+	}
+
+	c.readCache = nil
+	c.stopReadCache = nil
+}
+
+func (c *Container) RESTClientFactory() kube.RESTClientFactory {
+	if c.k8sRESTClientFactory == nil {
+		if len(c.Config.Clusters.List) > 0 {
+			c.k8sRESTClientFactory = c.MultiClusterRESTClientFactory()
+		} else {
+			c.k8sRESTClientFactory = kube.NewDefaultRESTClientFactory(
+				c.RESTConfigFactory(),
+				nil,
+				c.KubeconfigPath,
+				c.restClientFactoryOptions()...,
+			)
+		}
+	}
+
+	return c.k8sRESTClientFactory
+}
+
+// MultiClusterRESTClientFactory creates a client factory per configured cluster.
+func (c *Container) MultiClusterRESTClientFactory() *kube.MultiClusterRESTClientFactory {
+	if c.k8sClusters == nil {
+		factories := make(map[string]kube.RESTClientFactory, len(c.Config.Clusters.List))
+
+		for _, cluster := range c.Config.Clusters.List {
+			factories[cluster.Name] = kube.NewDefaultRESTClientFactory(
+				kube.NewClusterRESTConfigFactory(cluster),
+				nil,
+				c.KubeconfigPath,
+				c.restClientFactoryOptions()...,
+			)
 		}
 
-		c.k8sHTTPClient = k8sHTTPClient
+		c.k8sClusters = kube.NewMultiClusterRESTClientFactory(factories, c.Config.Clusters.Default)
 	}
 
-	return c.k8sHTTPClient
+	return c.k8sClusters
 }
 
-func (c *Container) K8sRestConfig() *rest.Config {
-	config, err := c.RESTConfigFactory().New(c.KubeconfigPath)
-	if err != nil {
-		panic(err)
+func (c *Container) ClustersHandler() http.Handler {
+	return proxy.NewClustersHandler(c.MultiClusterRESTClientFactory())
+}
+
+func (c *Container) restClientFactoryOptions() []kube.RESTClientFactoryOption {
+	return []kube.RESTClientFactoryOption{
+		kube.WithRequestHeaderPolicy(httpx.NewRequestHeaderPolicy(c.Config.Headers.Request)),
+		kube.WithImpersonation(c.Config.Impersonation),
+		kube.WithCredentialPassthrough(c.Config.Passthrough),
+	}
+}
+
+func (c *Container) RESTConfigFactory() *kube.DefaultRESTConfigFactory {
+	if c.k8sRESTConfigFactory == nil {
+		c.k8sRESTConfigFactory = kube.NewDefaultRESTConfigFactory()
 	}
 
-	return config
+	return c.k8sRESTConfigFactory
 }
@@ -3,11 +3,16 @@
 package app_test
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/omissis/kube-apiserver-proxy/internal/app"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
 )
 
 func TestHTTPServeMux(t *testing.T) {
@@ -18,6 +23,40 @@ func TestHTTPServeMux(t *testing.T) {
 	assert.NotNil(t, container.HTTPServeMux())
 }
 
+func TestHTTPServeMux_CORS(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, denyAllConfig)
+
+	container := app.NewContainer()
+
+	if err := container.ReloadConfig(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	origin := container.Parameters.APIAllowedOrigins[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	req.Header.Set("Origin", origin)
+
+	rec := httptest.NewRecorder()
+	container.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/pods", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	rec = httptest.NewRecorder()
+	container.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
 func TestHTTPServer(t *testing.T) {
 	t.Parallel()
 
@@ -43,3 +82,58 @@ func TestHTTPServer(t *testing.T) {
 
 // 	assert.NotNil(t, container.RESTClientFactory())
 // }
+
+func TestHealthRoutes(t *testing.T) {
+	t.Parallel()
+
+	container := app.NewContainer()
+	container.KubeconfigPath = filepath.Join(t.TempDir(), "missing-kubeconfig")
+	container.ReadinessTimeout = time.Second
+	container.Config = config.Config{
+		Middlewares: config.Middlewares{
+			Authorization: config.MiddlewareConfig[config.AuthorizationRule]{Enabled: true},
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		path           string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			desc:           "liveness",
+			path:           "/kasp/livez",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "ok",
+		},
+		{
+			desc:           "readiness without an apiserver",
+			path:           "/kasp/readyz",
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       "[+]shutdown ok\n[-]apiserver failed: reason withheld\nreadyz check failed\n",
+		},
+		{
+			desc:           "proxied requests still go through the middlewares",
+			path:           "/api/v1/pods",
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+
+			container.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tC.path, nil))
+
+			assert.Equal(t, tC.wantStatusCode, w.Code)
+
+			if tC.wantBody != "" {
+				assert.Equal(t, tC.wantBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/x/fsnotify"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+var ErrCannotReloadConfig = errors.New("cannot reload config")
+
+// Reload rebuilds the middleware chain, the proxy and its clients from the given config, and swaps them with
+// the current ones: requests already in flight complete with the services they started with, while the idle
+// connections of the replaced clients are closed. The rate limiter is kept when its rules are unchanged.
+// The tls certificate and the client ca bundle are not part of the config, they are reloaded by WatchCertificates.
+func (c *Container) Reload(cfg config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Config = cfg
+
+	c.StopReadCache()
+	c.closeRESTClientFactories()
+
+	c.httpServeMux = nil
+	c.k8sHTTProxy = nil
+	c.k8sRESTClientFactory = nil
+	c.k8sClusters = nil
+
+	// When the handler has not been created yet, it will be created from the new config on first use.
+	if c.handler != nil {
+		c.handler.Swap(c.routes())
+	}
+
+	if c.healthHandler != nil {
+		c.healthHandler.Swap(c.healthRoutes())
+	}
+
+	select {
+	case c.reloadedChan() <- struct{}{}:
+	default:
+	}
+}
+
+// ReloadConfig loads the config file at the given path and reloads the container with it,
+// leaving the current config in place if the new one is missing, empty, cannot be loaded or is not valid.
+func (c *Container) ReloadConfig(path string) error {
+	cfg, err := config.LoadRequired(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotReloadConfig, err)
+	}
+
+	c.Reload(cfg)
+
+	return nil
+}
+
+// WatchConfig reloads the config file every time it changes or the process receives a SIGHUP,
+// until the context is done.
+func (c *Container) WatchConfig(ctx context.Context, path string) error {
+	hup := make(chan os.Signal, 1)
+
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-hup:
+				c.reloadConfig(path, "signal")
+			}
+		}
+	}()
+
+	if path == "" {
+		<-ctx.Done()
+
+		return nil
+	}
+
+	return fsnotify.WatchFiles(ctx, []string{path}, func(string) {
+		c.reloadConfig(path, "file change")
+	})
+}
+
+func (c *Container) reloadConfig(path, trigger string) {
+	if path == "" {
+		slog.Info("no config file to reload", "trigger", trigger)
+
+		return
+	}
+
+	if err := c.ReloadConfig(path); err != nil {
+		slog.Error("keeping the current config", "error", err, "path", path, "trigger", trigger)
+
+		return
+	}
+
+	slog.Info("config reloaded", "path", path, "trigger", trigger)
+}
+
+// WatchKubeconfigs drops the cached clients every time one of the kubeconfig files in use changes,
+// so that rotated credentials and updated endpoints are picked up without restarting the proxy.
+// The set of watched files is updated on every config reload.
+func (c *Container) WatchKubeconfigs(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		reloaded := c.reloadedChan()
+		paths, onChange := c.kubeconfigWatch()
+		c.mu.Unlock()
+
+		wctx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+
+		go func() {
+			errs <- fsnotify.WatchFiles(wctx, paths, onChange)
+		}()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+
+			return <-errs
+
+		case <-reloaded:
+			cancel()
+
+			if err := <-errs; err != nil {
+				return err
+			}
+
+		case err := <-errs:
+			cancel()
+
+			return err
+		}
+	}
+}
+
+// kubeconfigWatch returns the kubeconfig files used by the current config, and the function dropping
+// the clients created from them. It must be called with the lock held.
+func (c *Container) kubeconfigWatch() ([]string, func(path string)) {
+	if len(c.Config.Clusters.List) == 0 {
+		return []string{c.KubeconfigPath}, func(path string) {
+			slog.Info("kubeconfig changed, dropping cached clients", "path", path)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if i, ok := c.RESTClientFactory().(kube.Invalidator); ok {
+				i.Invalidate()
+			}
+		}
+	}
+
+	clusters := make(map[string][]string)
+	paths := make([]string, 0, len(c.Config.Clusters.List))
+
+	for _, cluster := range c.Config.Clusters.List {
+		if cluster.InCluster {
+			continue
+		}
+
+		path := cluster.Kubeconfig
+		if path == "" {
+			path = c.KubeconfigPath
+		}
+
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+
+		clusters[path] = append(clusters[path], cluster.Name)
+		paths = append(paths, path)
+	}
+
+	return paths, func(path string) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for _, name := range clusters[path] {
+			slog.Info("kubeconfig changed, dropping cached clients", "path", path, "cluster", name)
+
+			c.MultiClusterRESTClientFactory().InvalidateCluster(name)
+		}
+	}
+}
+
+// closeRESTClientFactories drops the clients of the current factories and closes their idle connections.
+func (c *Container) closeRESTClientFactories() {
+	if i, ok := c.k8sRESTClientFactory.(kube.Invalidator); ok {
+		i.Invalidate()
+	}
+
+	// The multi-cluster factory is also created by the clusters handler when the proxy serves a single cluster.
+	if c.k8sClusters != nil && c.k8sRESTClientFactory != kube.RESTClientFactory(c.k8sClusters) {
+		c.k8sClusters.Invalidate()
+	}
+}
+
+func (c *Container) reloadedChan() chan struct{} {
+	if c.reloaded == nil {
+		c.reloaded = make(chan struct{}, 1)
+	}
+
+	return c.reloaded
+}
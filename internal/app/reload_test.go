@@ -0,0 +1,171 @@
+//go:build unit
+
+package app_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/app"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const denyAllConfig = `middlewares:
+  authorization:
+    enabled: true
+    config:
+      - name: deny-all
+        effect: deny
+`
+
+func TestReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, denyAllConfig)
+
+	container := app.NewContainer()
+
+	if err := container.ReloadConfig(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := serve(container); got != http.StatusForbidden {
+		t.Fatalf("expected status code %d, got %d", http.StatusForbidden, got)
+	}
+
+	writeConfig(t, path, "impersonation:\n  enabled: true\npassthrough:\n  enabled: true\n")
+
+	if err := container.ReloadConfig(path); !errors.Is(err, app.ErrCannotReloadConfig) {
+		t.Fatalf("expected error %v, got %v", app.ErrCannotReloadConfig, err)
+	}
+
+	if got := serve(container); got != http.StatusForbidden {
+		t.Errorf("expected the previous config to be kept, got status code %d", got)
+	}
+
+	for _, content := range []string{"", "# nothing here\n"} {
+		writeConfig(t, path, content)
+
+		if err := container.ReloadConfig(path); !errors.Is(err, config.ErrEmptyConfig) {
+			t.Fatalf("expected error %v, got %v", config.ErrEmptyConfig, err)
+		}
+
+		if got := serve(container); got != http.StatusForbidden {
+			t.Errorf("expected the previous config to be kept, got status code %d", got)
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("cannot remove config: %v", err)
+	}
+
+	if err := container.ReloadConfig(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error %v, got %v", os.ErrNotExist, err)
+	}
+
+	if got := serve(container); got != http.StatusForbidden {
+		t.Errorf("expected the previous config to be kept, got status code %d", got)
+	}
+
+	writeConfig(t, path, "{}\n")
+
+	if err := container.ReloadConfig(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := serve(container); got == http.StatusForbidden {
+		t.Errorf("expected the new config to be used, got status code %d", got)
+	}
+}
+
+func TestReloadKeepsRateLimits(t *testing.T) {
+	t.Parallel()
+
+	rateLimitConfig := func(name string) config.Config {
+		return config.Config{
+			Middlewares: config.Middlewares{
+				RateLimit: config.MiddlewareConfig[config.RateLimitRule]{
+					Enabled: true,
+					Config:  []config.RateLimitRule{{Name: name, Key: "ip", QPS: 0.001, Burst: 1}},
+				},
+			},
+		}
+	}
+
+	container := app.NewContainer()
+	container.Reload(rateLimitConfig("everyone"))
+
+	if got := serve(container); got == http.StatusTooManyRequests {
+		t.Fatalf("expected the first request to be allowed, got status code %d", got)
+	}
+
+	container.Reload(rateLimitConfig("everyone"))
+
+	if got := serve(container); got != http.StatusTooManyRequests {
+		t.Errorf("expected the buckets to be kept across reloads, got status code %d", got)
+	}
+
+	container.Reload(rateLimitConfig("anyone"))
+
+	if got := serve(container); got == http.StatusTooManyRequests {
+		t.Errorf("expected the buckets to be reset when the rules change, got status code %d", got)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "")
+
+	container := app.NewContainer()
+
+	if got := serve(container); got == http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = container.WatchConfig(ctx, path)
+	}()
+
+	// Give the watcher the time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	writeConfig(t, path, denyAllConfig)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for serve(container) != http.StatusForbidden {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the config to be reloaded")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("cannot write config: %v", err)
+	}
+}
+
+func serve(container *app.Container) int {
+	rec := httptest.NewRecorder()
+
+	container.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	return rec.Code
+}
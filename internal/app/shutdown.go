@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrShuttingDown      = errors.New("the proxy is shutting down")
+	ErrCannotDrainServer = errors.New("cannot drain the in-flight requests within the grace period")
+)
+
+// Shutdown stops the proxy gracefully:
+//  1. it marks the proxy as not ready, and waits for ShutdownDelay, so that it is taken out of the endpoints
+//     while it still serves the requests sent its way;
+//  2. it ends the open watches cleanly and stops accepting connections, waiting for the in-flight requests
+//     to complete until ShutdownGracePeriod expires, after which the remaining connections are closed;
+//  3. it stops the health and metrics servers.
+//
+// Calling it more than once is safe, though only the first call drains the servers.
+func (c *Container) Shutdown(ctx context.Context) error {
+	first := false
+
+	c.shutdownOnce.Do(func() {
+		first = true
+
+		close(c.notReady)
+	})
+
+	if !first {
+		return nil
+	}
+
+	slog.Info("shutting down", "delay", c.ShutdownDelay, "gracePeriod", c.ShutdownGracePeriod)
+
+	if c.ShutdownDelay > 0 {
+		select {
+		case <-time.After(c.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	close(c.drain)
+
+	ctx, cancel := context.WithTimeout(ctx, c.ShutdownGracePeriod)
+	defer cancel()
+
+	c.mu.Lock()
+	servers := []*http.Server{c.httpServer, c.healthServer, c.metricsServer}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.StopReadCache()
+		c.mu.Unlock()
+	}()
+
+	var errs []error
+
+	for _, srv := range servers {
+		if srv == nil {
+			continue
+		}
+
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrCannotDrainServer, err))
+
+			_ = srv.Close()
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+//go:build unit
+
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/app"
+)
+
+const kubeconfigTemplate = `apiVersion: v1
+kind: Config
+clusters:
+  - name: test
+    cluster:
+      server: %s
+contexts:
+  - name: test
+    context:
+      cluster: test
+      user: test
+current-context: test
+users:
+  - name: test
+    user:
+      token: test
+`
+
+func TestShutdownReadiness(t *testing.T) {
+	t.Parallel()
+
+	container := app.NewContainer()
+	container.KubeconfigPath = filepath.Join(t.TempDir(), "missing-kubeconfig")
+
+	if err := container.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+
+	container.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kasp/readyz?verbose", nil))
+
+	if want := "[-]shutdown failed: " + app.ErrShuttingDown.Error(); !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected %q to contain %q", rec.Body.String(), want)
+	}
+
+	if err := container.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected further shutdowns to be no-ops, got %v", err)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc    string
+		path    string
+		wantErr error
+	}{
+		{
+			desc: "open watches are ended",
+			path: "/api/v1/pods?watch=true",
+		},
+		{
+			desc:    "requests outliving the grace period are cut",
+			path:    "/api/v1/pods",
+			wantErr: app.ErrCannotDrainServer,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			received := make(chan struct{})
+
+			apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintln(w, `{"type":"ADDED","object":{"kind":"Pod"}}`)
+				w.(http.Flusher).Flush()
+
+				close(received)
+
+				<-r.Context().Done()
+			}))
+			t.Cleanup(apiserver.Close)
+
+			kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+			writeConfig(t, kubeconfig, fmt.Sprintf(kubeconfigTemplate, apiserver.URL))
+
+			container := app.NewContainer()
+			container.KubeconfigPath = kubeconfig
+			container.ShutdownGracePeriod = 500 * time.Millisecond
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("cannot listen: %v", err)
+			}
+
+			srv := container.HTTPServer()
+
+			go func() {
+				_ = srv.Serve(ln)
+			}()
+
+			go func() {
+				res, err := http.Get("http://" + ln.Addr().String() + tC.path)
+				if err == nil {
+					res.Body.Close()
+				}
+			}()
+
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the request to reach the apiserver")
+			}
+
+			if err := container.Shutdown(context.Background()); !errors.Is(err, tC.wantErr) {
+				t.Errorf("expected error %v, got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/x/fsnotify"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+var ErrIncompleteTLSConfig = errors.New("both a tls certificate and a key are required")
+
+// TLSEnabled tells whether the proxy is configured to terminate tls.
+func (c *Container) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != "" || c.TLSClientCAFile != ""
+}
+
+// TLSConfig serves the certificate kept up to date by Certificates and, when a client ca bundle is set,
+// verifies the client certificates against the one kept up to date by ClientCAs. Clients are not required
+// to present one, so that they can authenticate with a bearer token instead.
+func (c *Container) TLSConfig() (*tls.Config, error) {
+	if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+		return nil, ErrIncompleteTLSConfig
+	}
+
+	certs, err := c.Certificates()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if c.TLSClientCAFile != "" {
+		cas, err := c.ClientCAs()
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.ClientCAs = cas.Pool()
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+
+		// The ca bundle is read on every handshake, so that the reloaded one applies to the new connections.
+		base := cfg.Clone()
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			hc := base.Clone()
+			hc.ClientCAs = cas.Pool()
+
+			return hc, nil
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c *Container) Certificates() (*httpx.CertificateReloader, error) {
+	if c.certificates == nil {
+		certs, err := httpx.NewCertificateReloader(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCannotCreateContainer, err)
+		}
+
+		c.certificates = certs
+	}
+
+	return c.certificates, nil
+}
+
+func (c *Container) ClientCAs() (*httpx.CertPoolReloader, error) {
+	if c.clientCAs == nil {
+		cas, err := httpx.NewCertPoolReloader(c.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCannotCreateContainer, err)
+		}
+
+		c.clientCAs = cas
+	}
+
+	return c.clientCAs, nil
+}
+
+// WatchCertificates reloads the tls certificate and the client ca bundle every time their files change,
+// until the context is done.
+func (c *Container) WatchCertificates(ctx context.Context) error {
+	certs, err := c.Certificates()
+	if err != nil {
+		return err
+	}
+
+	files := certs.Files()
+	caFile := ""
+
+	if c.TLSClientCAFile != "" {
+		cas, err := c.ClientCAs()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, cas.Files()...)
+
+		if caFile, err = filepath.Abs(c.TLSClientCAFile); err != nil {
+			return fmt.Errorf("%w: %w", ErrCannotCreateContainer, err)
+		}
+	}
+
+	return fsnotify.WatchFiles(ctx, files, func(path string) {
+		if path == caFile {
+			if err := c.clientCAs.Reload(); err != nil {
+				slog.Warn("keeping the current client ca bundle", "error", err, "path", path)
+
+				return
+			}
+
+			slog.Info("client ca bundle reloaded", "path", path)
+
+			return
+		}
+
+		if err := certs.Reload(); err != nil {
+			slog.Warn("keeping the current tls certificate", "error", err, "path", path)
+
+			return
+		}
+
+		slog.Info("tls certificate reloaded", "path", path)
+	})
+}
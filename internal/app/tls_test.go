@@ -0,0 +1,261 @@
+//go:build unit
+
+package app_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/app"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"kind":"PodList","items":[]}`)
+	}))
+	t.Cleanup(apiserver.Close)
+
+	dir := t.TempDir()
+
+	ca, caKey := newCertificate(t, pkix.Name{CommonName: "kasp-ca"}, nil, nil)
+	server, serverKey := newCertificate(t, pkix.Name{CommonName: "kasp"}, ca, caKey)
+	client, clientKey := newCertificate(t, pkix.Name{CommonName: "jane", Organization: []string{"devs"}}, ca, caKey)
+
+	writeConfig(t, filepath.Join(dir, "kubeconfig"), fmt.Sprintf(kubeconfigTemplate, apiserver.URL))
+	writeConfig(t, filepath.Join(dir, "ca.crt"), encodeCertificate(t, ca))
+	writeConfig(t, filepath.Join(dir, "tls.crt"), encodeCertificate(t, server))
+	writeConfig(t, filepath.Join(dir, "tls.key"), encodeKey(t, serverKey))
+
+	container := app.NewContainer()
+	container.KubeconfigPath = filepath.Join(dir, "kubeconfig")
+	container.TLSCertFile = filepath.Join(dir, "tls.crt")
+	container.TLSKeyFile = filepath.Join(dir, "tls.key")
+	container.TLSClientCAFile = filepath.Join(dir, "ca.crt")
+	container.Config = config.Config{
+		Middlewares: config.Middlewares{
+			Authorization: config.MiddlewareConfig[config.AuthorizationRule]{
+				Enabled: true,
+				Config: []config.AuthorizationRule{
+					{Name: "devs", Effect: "allow", Groups: []string{"devs"}},
+				},
+			},
+		},
+	}
+
+	tlsConfig, err := container.TLSConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := container.HTTPServer()
+	srv.TLSConfig = tlsConfig
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	testCases := []struct {
+		desc           string
+		certificates   []tls.Certificate
+		wantStatusCode int
+	}{
+		{
+			desc: "client certificate of an allowed group",
+			certificates: []tls.Certificate{
+				{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey},
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "no client certificate",
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			hc := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						MinVersion:   tls.VersionTLS12,
+						RootCAs:      roots,
+						ServerName:   "127.0.0.1",
+						Certificates: tC.certificates,
+					},
+				},
+			}
+
+			res, err := hc.Get("https://" + ln.Addr().String() + "/api/v1/pods")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tC.wantStatusCode {
+				t.Errorf("expected status code %d, got %d", tC.wantStatusCode, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestTLSConfigClientCAReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	ca, caKey := newCertificate(t, pkix.Name{CommonName: "kasp-ca"}, nil, nil)
+	server, serverKey := newCertificate(t, pkix.Name{CommonName: "kasp"}, ca, caKey)
+	rotated, _ := newCertificate(t, pkix.Name{CommonName: "kasp-ca-2"}, nil, nil)
+
+	writeConfig(t, filepath.Join(dir, "ca.crt"), encodeCertificate(t, ca))
+	writeConfig(t, filepath.Join(dir, "tls.crt"), encodeCertificate(t, server))
+	writeConfig(t, filepath.Join(dir, "tls.key"), encodeKey(t, serverKey))
+
+	container := app.NewContainer()
+	container.TLSCertFile = filepath.Join(dir, "tls.crt")
+	container.TLSKeyFile = filepath.Join(dir, "tls.key")
+	container.TLSClientCAFile = filepath.Join(dir, "ca.crt")
+
+	tlsConfig, err := container.TLSConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeConfig(t, filepath.Join(dir, "ca.crt"), encodeCertificate(t, rotated))
+
+	cas, err := container.ClientCAs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := cas.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hc, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := x509.NewCertPool()
+	want.AddCert(rotated)
+
+	if !hc.ClientCAs.Equal(want) {
+		t.Error("expected the handshakes to use the reloaded client ca bundle")
+	}
+}
+
+func TestTLSConfigIncomplete(t *testing.T) {
+	t.Parallel()
+
+	container := app.NewContainer()
+	container.TLSClientCAFile = filepath.Join(t.TempDir(), "ca.crt")
+
+	if !container.TLSEnabled() {
+		t.Fatal("expected tls to be enabled")
+	}
+
+	if _, err := container.TLSConfig(); !errors.Is(err, app.ErrIncompleteTLSConfig) {
+		t.Errorf("expected error %v, got %v", app.ErrIncompleteTLSConfig, err)
+	}
+}
+
+// newCertificate creates a certificate for the given subject, valid for 127.0.0.1, signed by the given parent,
+// or self-signed and usable as a ca when there is none.
+func newCertificate(
+	t *testing.T,
+	subject pkix.Name,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("cannot generate serial number: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("cannot parse certificate: %v", err)
+	}
+
+	return cert, key
+}
+
+func encodeCertificate(t *testing.T, cert *x509.Certificate) string {
+	t.Helper()
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func encodeKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slog"
 
 	"github.com/omissis/kube-apiserver-proxy/internal/app"
 	cobrax "github.com/omissis/kube-apiserver-proxy/internal/x/cobra"
+	"github.com/omissis/kube-apiserver-proxy/pkg/logging"
 )
 
 type RootCommand struct {
@@ -21,7 +25,7 @@ func NewRootCommand(versions map[string]string) *RootCommand {
 			PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 				cobrax.BindFlags(cmd, cobrax.InitEnvs(envPrefix), log.Fatal, envPrefix)
 
-				return nil
+				return setupLogger(cmd)
 			},
 			Use:           "kube-apiserver-proxy",
 			SilenceUsage:  true,
@@ -29,6 +33,18 @@ func NewRootCommand(versions map[string]string) *RootCommand {
 		},
 	}
 
+	root.PersistentFlags().String(
+		"log-level",
+		"info",
+		"(optional) minimum level of the logs, one of: debug, info, warn, error",
+	)
+
+	root.PersistentFlags().String(
+		"log-format",
+		logging.FormatJSON,
+		"(optional) format of the logs, one of: json, logfmt",
+	)
+
 	cobrax.BindFlags(root.Command, cobrax.InitEnvs(envPrefix), log.Fatal, envPrefix)
 
 	root.AddCommand(NewVersionCommand(versions))
@@ -36,3 +52,24 @@ func NewRootCommand(versions map[string]string) *RootCommand {
 
 	return root
 }
+
+func setupLogger(cmd *cobra.Command) error {
+	level, err := cmd.Flags().GetString("log-level")
+	if err != nil {
+		return fmt.Errorf("%w '%s': %w", ErrParsingFlag, "log-level", err)
+	}
+
+	format, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return fmt.Errorf("%w '%s': %w", ErrParsingFlag, "log-format", err)
+	}
+
+	logger, err := logging.New(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/exp/slog"
 	"k8s.io/client-go/util/homedir"
 
 	"github.com/omissis/kube-apiserver-proxy/internal/app"
@@ -20,8 +22,17 @@ import (
 var ErrParsingFlag = errors.New("cannot parse command-line flag")
 
 type ServeCommandFlags struct {
-	Kubeconfig string
-	Config     string
+	Kubeconfig          string
+	Config              string
+	MetricsAddress      string
+	TracingEndpoint     string
+	HealthAddress       string
+	HealthPathPrefix    string
+	ShutdownDelay       time.Duration
+	ShutdownGracePeriod time.Duration
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSClientCAFile     string
 }
 
 func NewServeCommand(ctr *app.Container) *cobra.Command {
@@ -30,64 +41,114 @@ func NewServeCommand(ctr *app.Container) *cobra.Command {
 		Short: "Run kube-apiserver-proxy server",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			var cfg config.Config
-
-			fmt.Println("Running the kube-apiserver-proxy server...")
+			slog.Info("running the kube-apiserver-proxy server")
 
 			flags, err := getServeCommandFlags(cmd)
 			if err != nil {
 				return err
 			}
 
-			config, err := os.ReadFile(flags.Config)
-			if err != nil && !errors.Is(err, os.ErrNotExist) {
-				return fmt.Errorf("config read failed: %w", err)
+			cfg, err := config.Load(flags.Config)
+			if err != nil {
+				return err
 			}
 
-			if err := yaml.Unmarshal(config, &cfg); err != nil {
-				return fmt.Errorf("config unmarshal failed: %w", err)
+			ctr.KubeconfigPath = flags.Kubeconfig
+			ctr.MetricsAddress = flags.MetricsAddress
+			ctr.TracingEndpoint = flags.TracingEndpoint
+			ctr.HealthAddress = flags.HealthAddress
+			ctr.HealthPathPrefix = flags.HealthPathPrefix
+			ctr.ShutdownDelay = flags.ShutdownDelay
+			ctr.ShutdownGracePeriod = flags.ShutdownGracePeriod
+			ctr.TLSCertFile = flags.TLSCertFile
+			ctr.TLSKeyFile = flags.TLSKeyFile
+			ctr.TLSClientCAFile = flags.TLSClientCAFile
+			ctr.Config = cfg
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+			defer stop()
+
+			srv := ctr.HTTPServer()
+
+			if ctr.TLSEnabled() {
+				if srv.TLSConfig, err = ctr.TLSConfig(); err != nil {
+					return err
+				}
+
+				go func() {
+					if err := ctr.WatchCertificates(ctx); err != nil {
+						slog.Warn("cannot watch tls certificate files, renewals will require a restart", "error", err)
+					}
+				}()
 			}
 
-			validate := validator.New()
+			if ctr.MetricsAddress != "" {
+				serveInBackground(ctr.MetricsServer(), "metrics")
+			}
 
-			if err := validate.Struct(cfg); err != nil {
-				return fmt.Errorf("config validation failed: %w", err)
+			if ctr.HealthAddress != "" {
+				serveInBackground(ctr.HealthServer(), "health")
 			}
 
-			ctr.KubeconfigPath = flags.Kubeconfig
-			ctr.Config = cfg
+			go func() {
+				if err := ctr.WatchConfig(ctx, flags.Config); err != nil {
+					slog.Warn("cannot watch config file, changes will require a SIGHUP or a restart", "error", err)
+				}
+			}()
 
-			ctr.HTTPServeMux().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-				if r == nil {
-					http.Error(w, "request is empty", http.StatusInternalServerError)
+			go func() {
+				if err := ctr.WatchKubeconfigs(ctx); err != nil {
+					slog.Warn("cannot watch kubeconfig files, changes will require a restart", "error", err)
+				}
+			}()
 
-					return
+			defer func() {
+				if err := ctr.ShutdownTracing(context.Background()); err != nil {
+					slog.Error("cannot flush traces", "error", err)
 				}
+			}()
+
+			served := make(chan error, 1)
 
-				if w == nil {
-					http.Error(w, "response is empty", http.StatusInternalServerError)
+			go func() {
+				if srv.TLSConfig != nil {
+					// The certificate is served by the tls config, which keeps it up to date.
+					served <- srv.ListenAndServeTLS("", "")
 
 					return
 				}
 
-				ctx, cancel := context.WithCancel(r.Context())
-				defer cancel()
+				served <- srv.ListenAndServe()
+			}()
 
-				if err := ctr.K8sHTTPProxy().DoServeHTTP(ctx, w, *r); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				}
-			})
+			select {
+			case err := <-served:
+				return err
 
-			return ctr.HTTPServer().ListenAndServe()
+			case <-ctx.Done():
+			}
+
+			// Restoring the default behavior lets a second signal terminate the process right away.
+			stop()
+
+			return ctr.Shutdown(context.Background())
 		},
 	}
 
-	setupServeCommandFlags(cmd)
+	setupServeCommandFlags(cmd, ctr.Parameters)
 
 	return cmd
 }
 
-func setupServeCommandFlags(cmd *cobra.Command) {
+func serveInBackground(srv *http.Server, name string) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(name+" server failed", "error", err)
+		}
+	}()
+}
+
+func setupServeCommandFlags(cmd *cobra.Command, params app.Parameters) {
 	kubeconfigDefault := ""
 
 	if home := homedir.HomeDir(); home != "" {
@@ -105,6 +166,62 @@ func setupServeCommandFlags(cmd *cobra.Command) {
 		"",
 		"(optional) absolute path to the config file",
 	)
+
+	cmd.Flags().String(
+		"metrics-address",
+		params.MetricsAddress,
+		"(optional) address the metrics are served on, leave empty to disable them",
+	)
+
+	cmd.Flags().String(
+		"tracing-endpoint",
+		params.TracingEndpoint,
+		"(optional) url of the OTLP/HTTP collector the traces are exported to, such as http://otel-collector:4318",
+	)
+
+	cmd.Flags().String(
+		"health-address",
+		params.HealthAddress,
+		"(optional) address the /livez and /readyz probes are served on, leave empty to serve them along with the proxy",
+	)
+
+	cmd.Flags().String(
+		"health-path-prefix",
+		params.HealthPathPrefix,
+		"(optional) path prefix of the /livez and /readyz probes",
+	)
+
+	cmd.Flags().Duration(
+		"shutdown-delay",
+		params.ShutdownDelay,
+		"(optional) time to keep serving requests after a SIGTERM, while reporting not ready, before draining",
+	)
+
+	cmd.Flags().Duration(
+		"shutdown-grace-period",
+		params.ShutdownGracePeriod,
+		"(optional) maximum time to wait for the in-flight requests to complete when shutting down",
+	)
+
+	cmd.Flags().String(
+		"tls-cert-file",
+		params.TLSCertFile,
+		"(optional) path to the pem encoded certificate served by the proxy, reloaded on change, "+
+			"leave empty to serve plain http",
+	)
+
+	cmd.Flags().String(
+		"tls-key-file",
+		params.TLSKeyFile,
+		"(optional) path to the pem encoded private key of the certificate served by the proxy",
+	)
+
+	cmd.Flags().String(
+		"tls-client-ca-file",
+		params.TLSClientCAFile,
+		"(optional) path to the pem encoded ca bundle the client certificates are verified against, "+
+			"their common name and organizations are used as username and groups",
+	)
 }
 
 func getServeCommandFlags(cmd *cobra.Command) (ServeCommandFlags, error) {
@@ -118,8 +235,62 @@ func getServeCommandFlags(cmd *cobra.Command) (ServeCommandFlags, error) {
 		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "config", err)
 	}
 
+	metricsAddress, err := cmd.Flags().GetString("metrics-address")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "metrics-address", err)
+	}
+
+	tracingEndpoint, err := cmd.Flags().GetString("tracing-endpoint")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "tracing-endpoint", err)
+	}
+
+	healthAddress, err := cmd.Flags().GetString("health-address")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "health-address", err)
+	}
+
+	healthPathPrefix, err := cmd.Flags().GetString("health-path-prefix")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "health-path-prefix", err)
+	}
+
+	shutdownDelay, err := cmd.Flags().GetDuration("shutdown-delay")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "shutdown-delay", err)
+	}
+
+	shutdownGracePeriod, err := cmd.Flags().GetDuration("shutdown-grace-period")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "shutdown-grace-period", err)
+	}
+
+	tlsCertFile, err := cmd.Flags().GetString("tls-cert-file")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "tls-cert-file", err)
+	}
+
+	tlsKeyFile, err := cmd.Flags().GetString("tls-key-file")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "tls-key-file", err)
+	}
+
+	tlsClientCAFile, err := cmd.Flags().GetString("tls-client-ca-file")
+	if err != nil {
+		return ServeCommandFlags{}, fmt.Errorf("%w '%s': %w", ErrParsingFlag, "tls-client-ca-file", err)
+	}
+
 	return ServeCommandFlags{
-		Kubeconfig: kubeconfig,
-		Config:     config,
+		Kubeconfig:          kubeconfig,
+		Config:              config,
+		MetricsAddress:      metricsAddress,
+		TracingEndpoint:     tracingEndpoint,
+		HealthAddress:       healthAddress,
+		HealthPathPrefix:    healthPathPrefix,
+		ShutdownDelay:       shutdownDelay,
+		ShutdownGracePeriod: shutdownGracePeriod,
+		TLSCertFile:         tlsCertFile,
+		TLSKeyFile:          tlsKeyFile,
+		TLSClientCAFile:     tlsClientCAFile,
 	}, nil
 }
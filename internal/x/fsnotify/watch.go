@@ -0,0 +1,95 @@
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// kubeletDataDir is the symlink swapped by the kubelet when updating the files of mounted secrets and config maps.
+const kubeletDataDir = "..data"
+
+var ErrCannotWatchFile = errors.New("cannot watch file")
+
+// WatchFiles calls onChange with the path of the changed file every time one of the given files is written,
+// created, renamed or removed, until the context is done.
+// The parent directories are watched rather than the files themselves, so that atomic replacements, such as
+// the ones made by editors or by the kubelet updating mounted secrets and config maps, are noticed too.
+func WatchFiles(ctx context.Context, paths []string, onChange func(path string)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWatchFile, err)
+	}
+	defer w.Close()
+
+	files := make(map[string][]string)
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("%w '%s': %w", ErrCannotWatchFile, p, err)
+		}
+
+		dir := filepath.Dir(abs)
+
+		if _, ok := files[dir]; !ok {
+			if err := w.Add(dir); err != nil {
+				return fmt.Errorf("%w '%s': %w", ErrCannotWatchFile, p, err)
+			}
+		}
+
+		files[dir] = append(files[dir], abs)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+
+			for _, f := range changedFiles(files, ev.Name) {
+				onChange(f)
+			}
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+
+			return fmt.Errorf("%w: %w", ErrCannotWatchFile, err)
+		}
+	}
+}
+
+func changedFiles(files map[string][]string, name string) []string {
+	name = filepath.Clean(name)
+	dir := filepath.Dir(name)
+
+	if strings.HasPrefix(filepath.Base(name), kubeletDataDir) {
+		return files[dir]
+	}
+
+	for _, f := range files[dir] {
+		if f == name {
+			return []string{f}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+//go:build unit
+
+package fsnotify_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omissis/kube-apiserver-proxy/internal/x/fsnotify"
+)
+
+func TestWatchFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "kubeconfig")
+	other := filepath.Join(dir, "other")
+
+	if err := os.WriteFile(watched, []byte("v1"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan string, 10)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- fsnotify.WatchFiles(ctx, []string{watched}, func(path string) {
+			changes <- path
+		})
+	}()
+
+	// Give the watcher the time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(other, []byte("v1"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+
+	// Replace the file atomically, as editors and the kubelet do.
+	tmp := filepath.Join(dir, ".kubeconfig.tmp")
+	if err := os.WriteFile(tmp, []byte("v2"), 0o600); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+
+	if err := os.Rename(tmp, watched); err != nil {
+		t.Fatalf("cannot rename file: %v", err)
+	}
+
+	select {
+	case got := <-changes:
+		if got != watched {
+			t.Errorf("expected change of %s, got %s", watched, got)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change to be notified")
+	}
+
+	cancel()
+
+	if err := <-errs; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWatchFiles_MissingDirectory(t *testing.T) {
+	t.Parallel()
+
+	err := fsnotify.WatchFiles(context.Background(), []string{"/does/not/exist/kubeconfig"}, func(string) {})
+	if err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
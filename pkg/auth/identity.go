@@ -0,0 +1,46 @@
+package auth
+
+import "context"
+
+const (
+	AnonymousUser        = "system:anonymous"
+	AuthenticatedGroup   = "system:authenticated"
+	UnauthenticatedGroup = "system:unauthenticated"
+)
+
+type identityKey struct{}
+
+// Identity describes the caller of a request, as established by one of the authentication middlewares.
+type Identity struct {
+	Username string
+	Groups   []string
+	Extra    map[string][]string
+	// Claims contains the raw claims of the token used to authenticate the caller, if any.
+	Claims map[string]any
+	// Method is the authentication method used to establish the identity, e.g.: "jwt".
+	Method string
+}
+
+// Anonymous returns the identity used for requests that carry no credentials.
+func Anonymous() *Identity {
+	return &Identity{
+		Username: AnonymousUser,
+		Groups:   []string{UnauthenticatedGroup},
+	}
+}
+
+// IsAnonymous tells whether the identity is missing or belongs to an unauthenticated caller.
+func (id *Identity) IsAnonymous() bool {
+	return id == nil || id.Username == "" || id.Username == AnonymousUser
+}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity stored in the context, if any.
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+
+	return id, ok && id != nil
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const (
+	defaultUsernameClaim = "sub"
+	defaultGroupsClaim   = "groups"
+)
+
+var (
+	ErrInvalidToken            = errors.New("invalid token")
+	ErrMissingUsernameClaim    = errors.New("username claim is missing or empty")
+	ErrUnexpectedIssuer        = errors.New("unexpected token issuer")
+	ErrUnsupportedClaimType    = errors.New("unsupported claim type")
+	ErrUnsupportedSignatureAlg = errors.New("unsupported signature algorithm")
+)
+
+// supportedSignatureAlgorithms excludes symmetric algorithms, as the keys come from a public key set.
+var supportedSignatureAlgorithms = map[jose.SignatureAlgorithm]struct{}{
+	jose.RS256: {}, jose.RS384: {}, jose.RS512: {},
+	jose.PS256: {}, jose.PS384: {}, jose.PS512: {},
+	jose.ES256: {}, jose.ES384: {}, jose.ES512: {},
+	jose.EdDSA: {},
+}
+
+func NewJWTAuthenticator(conf config.JWTAuthenticatorConfig, keys KeySet) *JWTAuthenticator {
+	if conf.UsernameClaim == "" {
+		conf.UsernameClaim = defaultUsernameClaim
+	}
+
+	if conf.GroupsClaim == "" {
+		conf.GroupsClaim = defaultGroupsClaim
+	}
+
+	return &JWTAuthenticator{
+		conf: conf,
+		keys: keys,
+		now:  time.Now,
+	}
+}
+
+// NewJWTAuthenticatorFromConfig builds the authenticator and the key set described by the config.
+func NewJWTAuthenticatorFromConfig(conf config.JWTAuthenticatorConfig) *JWTAuthenticator {
+	var keys KeySet = NewFileKeySet(conf.JWKSFile)
+
+	if conf.JWKSURL != "" {
+		keys = NewRemoteKeySet(conf.JWKSURL, nil, conf.JWKSRefresh)
+	}
+
+	return NewJWTAuthenticator(conf, keys)
+}
+
+// JWTAuthenticator verifies bearer tokens issued by a single issuer and maps their claims to an Identity.
+type JWTAuthenticator struct {
+	conf config.JWTAuthenticatorConfig
+	keys KeySet
+	now  func() time.Time
+}
+
+// Issuer returns the issuer trusted by the authenticator.
+func (a *JWTAuthenticator) Issuer() string {
+	return a.conf.Issuer
+}
+
+// Authenticate verifies the signature, the issuer, the audience and the validity period of the token,
+// and returns the identity described by its claims.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if len(tok.Headers) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signature", ErrInvalidToken)
+	}
+
+	if _, ok := supportedSignatureAlgorithms[jose.SignatureAlgorithm(tok.Headers[0].Algorithm)]; !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedSignatureAlg, tok.Headers[0].Algorithm)
+	}
+
+	keys, err := a.keys.Keys(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	var (
+		registered jwt.Claims
+		claims     map[string]any
+		verifyErr  error
+	)
+
+	for _, key := range keys {
+		if verifyErr = tok.Claims(key.Public(), &registered, &claims); verifyErr == nil {
+			break
+		}
+	}
+
+	if verifyErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, verifyErr)
+	}
+
+	if err := a.validate(registered); err != nil {
+		return nil, err
+	}
+
+	return a.identity(claims)
+}
+
+func (a *JWTAuthenticator) validate(registered jwt.Claims) error {
+	if registered.Issuer != a.conf.Issuer {
+		return fmt.Errorf("%w: '%s'", ErrUnexpectedIssuer, registered.Issuer)
+	}
+
+	if registered.Expiry == nil {
+		return fmt.Errorf("%w: expiration time is missing", ErrInvalidToken)
+	}
+
+	leeway := a.conf.AllowedClockSkew
+	if leeway == 0 {
+		leeway = jwt.DefaultLeeway
+	}
+
+	if err := registered.ValidateWithLeeway(jwt.Expected{Time: a.now()}, leeway); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	for _, aud := range a.conf.Audiences {
+		if registered.Audience.Contains(aud) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %w", ErrInvalidToken, jwt.ErrInvalidAudience)
+}
+
+func (a *JWTAuthenticator) identity(claims map[string]any) (*Identity, error) {
+	username, ok := claims[a.conf.UsernameClaim].(string)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("%w: '%s'", ErrMissingUsernameClaim, a.conf.UsernameClaim)
+	}
+
+	groups, err := claimValues(claims, a.conf.GroupsClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := make(map[string][]string, len(a.conf.ExtraClaims))
+
+	for _, c := range a.conf.ExtraClaims {
+		vv, err := claimValues(claims, c)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(vv) > 0 {
+			extra[c] = vv
+		}
+	}
+
+	return &Identity{
+		Username: username,
+		Groups:   append(groups, AuthenticatedGroup),
+		Extra:    extra,
+		Claims:   claims,
+		Method:   "jwt",
+	}, nil
+}
+
+// claimValues returns the values of a claim that can either be a string or a list of strings.
+func claimValues(claims map[string]any, name string) ([]string, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return []string{}, nil
+
+	case string:
+		return []string{v}, nil
+
+	case []any:
+		values := make([]string, 0, len(v))
+
+		for _, vv := range v {
+			s, ok := vv.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: claim '%s' contains a non-string value", ErrUnsupportedClaimType, name)
+			}
+
+			values = append(values, s)
+		}
+
+		return values, nil
+
+	default:
+		return nil, fmt.Errorf("%w: claim '%s' is a %T", ErrUnsupportedClaimType, name, v)
+	}
+}
+
+// BearerToken extracts the token from the value of an Authorization header.
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
@@ -0,0 +1,289 @@
+//go:build unit
+
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const (
+	testIssuer   = "https://issuer.kube-apiserver-proxy.test"
+	testAudience = "kube-apiserver-proxy"
+	testKeyID    = "test-key"
+)
+
+func TestJWTAuthenticator_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	key := newTestKey(t)
+	jwksFile := writeTestKeySet(t, key)
+
+	now := time.Now()
+
+	validClaims := jwt.Claims{
+		Issuer:   testIssuer,
+		Subject:  "jane",
+		Audience: jwt.Audience{testAudience},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now),
+	}
+
+	testCases := []struct {
+		desc    string
+		conf    config.JWTAuthenticatorConfig
+		token   string
+		want    *auth.Identity
+		wantErr error
+	}{
+		{
+			desc: "valid token",
+			conf: config.JWTAuthenticatorConfig{ExtraClaims: []string{"tenant"}},
+			token: signTestToken(t, key, testKeyID, validClaims, map[string]any{
+				"groups": []string{"dev", "ops"},
+				"tenant": "acme",
+			}),
+			want: &auth.Identity{
+				Username: "jane",
+				Groups:   []string{"dev", "ops", auth.AuthenticatedGroup},
+				Extra:    map[string][]string{"tenant": {"acme"}},
+				Method:   "jwt",
+			},
+		},
+		{
+			desc: "custom claims",
+			conf: config.JWTAuthenticatorConfig{UsernameClaim: "email", GroupsClaim: "roles"},
+			token: signTestToken(t, key, testKeyID, validClaims, map[string]any{
+				"email": "jane@kube-apiserver-proxy.test",
+				"roles": "admin",
+			}),
+			want: &auth.Identity{
+				Username: "jane@kube-apiserver-proxy.test",
+				Groups:   []string{"admin", auth.AuthenticatedGroup},
+				Extra:    map[string][]string{},
+				Method:   "jwt",
+			},
+		},
+		{
+			desc:    "malformed token",
+			token:   "not-a-token",
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			desc: "expired token",
+			token: signTestToken(t, key, testKeyID, jwt.Claims{
+				Issuer:   testIssuer,
+				Subject:  "jane",
+				Audience: jwt.Audience{testAudience},
+				Expiry:   jwt.NewNumericDate(now.Add(-time.Hour)),
+			}, nil),
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			desc: "token without expiration",
+			token: signTestToken(t, key, testKeyID, jwt.Claims{
+				Issuer:   testIssuer,
+				Subject:  "jane",
+				Audience: jwt.Audience{testAudience},
+			}, nil),
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			desc: "wrong audience",
+			token: signTestToken(t, key, testKeyID, jwt.Claims{
+				Issuer:   testIssuer,
+				Subject:  "jane",
+				Audience: jwt.Audience{"someone-else"},
+				Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+			}, nil),
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			desc: "wrong issuer",
+			token: signTestToken(t, key, testKeyID, jwt.Claims{
+				Issuer:   "https://evil.test",
+				Subject:  "jane",
+				Audience: jwt.Audience{testAudience},
+				Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+			}, nil),
+			wantErr: auth.ErrUnexpectedIssuer,
+		},
+		{
+			desc:    "unknown key",
+			token:   signTestToken(t, newTestKey(t), "other-key", validClaims, nil),
+			wantErr: auth.ErrKeyNotFound,
+		},
+		{
+			desc:    "signed with another key",
+			token:   signTestToken(t, newTestKey(t), testKeyID, validClaims, nil),
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			desc:    "missing username",
+			conf:    config.JWTAuthenticatorConfig{UsernameClaim: "email"},
+			token:   signTestToken(t, key, testKeyID, validClaims, nil),
+			wantErr: auth.ErrMissingUsernameClaim,
+		},
+		{
+			desc: "invalid groups claim",
+			token: signTestToken(t, key, testKeyID, validClaims, map[string]any{
+				"groups": 42,
+			}),
+			wantErr: auth.ErrUnsupportedClaimType,
+		},
+		{
+			desc:    "symmetric signature",
+			token:   signTestHMACToken(t, validClaims),
+			wantErr: auth.ErrUnsupportedSignatureAlg,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			conf := tC.conf
+			conf.Issuer = testIssuer
+			conf.Audiences = []string{testAudience}
+			conf.JWKSFile = jwksFile
+
+			got, err := auth.NewJWTAuthenticatorFromConfig(conf).Authenticate(context.Background(), tC.token)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if tC.want == nil {
+				return
+			}
+
+			if diff := cmp.Diff(tC.want, got, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "Claims"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("identity mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc   string
+		header string
+		want   string
+		wantOk bool
+	}{
+		{desc: "empty header", header: "", want: "", wantOk: false},
+		{desc: "bearer token", header: "Bearer abc", want: "abc", wantOk: true},
+		{desc: "lowercase scheme", header: "bearer abc", want: "abc", wantOk: true},
+		{desc: "basic auth", header: "Basic YWJjOmRlZg==", want: "", wantOk: false},
+		{desc: "empty token", header: "Bearer ", want: "", wantOk: false},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := auth.BearerToken(tC.header)
+			if got != tC.want || ok != tC.wantOk {
+				t.Errorf("BearerToken() = (%q, %v), want (%q, %v)", got, ok, tC.want, tC.wantOk)
+			}
+		})
+	}
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+
+	return key
+}
+
+func testKeySet(key *rsa.PrivateKey) jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{Key: key.Public(), KeyID: testKeyID, Algorithm: string(jose.RS256), Use: "sig"},
+		},
+	}
+}
+
+func writeTestKeySet(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	data, err := json.Marshal(testKeySet(key))
+	if err != nil {
+		t.Fatalf("cannot marshal key set: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("cannot write key set: %v", err)
+	}
+
+	return path
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.Claims, extra map[string]any) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: kid}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		t.Fatalf("cannot create signer: %v", err)
+	}
+
+	builder := jwt.Signed(signer).Claims(claims)
+	if extra != nil {
+		builder = builder.Claims(extra)
+	}
+
+	token, err := builder.CompactSerialize()
+	if err != nil {
+		t.Fatalf("cannot sign token: %v", err)
+	}
+
+	return token
+}
+
+func signTestHMACToken(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: jose.JSONWebKey{Key: []byte("0123456789abcdef0123456789abcdef"), KeyID: testKeyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		t.Fatalf("cannot create signer: %v", err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("cannot sign token: %v", err)
+	}
+
+	return token
+}
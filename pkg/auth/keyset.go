@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const (
+	defaultJWKSRefreshInterval = time.Hour
+	minJWKSRefreshInterval     = 10 * time.Second
+	maxJWKSResponseSize        = 1 << 20
+)
+
+var (
+	ErrCannotFetchKeySet = errors.New("cannot fetch json web key set")
+	ErrCannotReadKeySet  = errors.New("cannot read json web key set")
+	ErrKeyNotFound       = errors.New("json web key not found")
+)
+
+// KeySet provides the keys used to verify the signature of the tokens.
+type KeySet interface {
+	Keys(ctx context.Context, kid string) ([]jose.JSONWebKey, error)
+}
+
+// NewFileKeySet returns a KeySet reading the keys from a local file, which is read again
+// when a token references a key id that is not known yet, at most once every minJWKSRefreshInterval.
+func NewFileKeySet(path string) *FileKeySet {
+	return &FileKeySet{path: path, now: time.Now}
+}
+
+type FileKeySet struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	keys    jose.JSONWebKeySet
+	readAt  time.Time
+	readErr error
+}
+
+func (f *FileKeySet) Keys(_ context.Context, kid string) ([]jose.JSONWebKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if keys := lookupKeys(f.keys, kid); len(keys) > 0 {
+		return keys, nil
+	}
+
+	// Throttle the reads triggered by unknown key ids, so that forged tokens do not hit the disk every time.
+	if f.readAt.IsZero() || f.now().Sub(f.readAt) >= minJWKSRefreshInterval {
+		f.readAt = f.now()
+		f.readErr = f.read()
+	}
+
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+
+	if keys := lookupKeys(f.keys, kid); len(keys) > 0 {
+		return keys, nil
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrKeyNotFound, kid)
+}
+
+func (f *FileKeySet) read() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotReadKeySet, err)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotReadKeySet, err)
+	}
+
+	f.keys = keys
+
+	return nil
+}
+
+// NewRemoteKeySet returns a KeySet fetching the keys from the given url, which are cached and refreshed
+// periodically, or as soon as a token references a key id that is not known yet.
+// The refreshes happen at most once every minJWKSRefreshInterval, and the concurrent callers share the same fetch.
+func NewRemoteKeySet(url string, httpClient *http.Client, refreshInterval time.Duration) *RemoteKeySet {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	if refreshInterval <= 0 {
+		refreshInterval = defaultJWKSRefreshInterval
+	}
+
+	return &RemoteKeySet{
+		url:             url,
+		httpClient:      httpClient,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+	}
+}
+
+type RemoteKeySet struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu          sync.Mutex
+	keys        jose.JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	inflight    *keySetFetch
+}
+
+// keySetFetch is a fetch in progress, whose result is shared by all the callers waiting for it.
+type keySetFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func (r *RemoteKeySet) Keys(ctx context.Context, kid string) ([]jose.JSONWebKey, error) {
+	r.mu.Lock()
+	cached := lookupKeys(r.keys, kid)
+	fresh := r.now().Sub(r.fetchedAt) < r.refreshInterval
+	r.mu.Unlock()
+
+	if len(cached) > 0 && fresh {
+		return cached, nil
+	}
+
+	if err := r.refresh(ctx); err != nil {
+		// Stale keys are better than no keys at all when the issuer is temporarily unavailable.
+		if len(cached) > 0 {
+			return cached, nil
+		}
+
+		return nil, err
+	}
+
+	r.mu.Lock()
+	keys := lookupKeys(r.keys, kid)
+	r.mu.Unlock()
+
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrKeyNotFound, kid)
+}
+
+// refresh fetches the keys again, unless another fetch was attempted less than minJWKSRefreshInterval ago,
+// so that forged tokens cannot flood the issuer. The fetch happens outside of the lock, and the callers
+// arriving while it is in progress wait for its result rather than starting their own.
+func (r *RemoteKeySet) refresh(ctx context.Context) error {
+	r.mu.Lock()
+
+	if call := r.inflight; call != nil {
+		r.mu.Unlock()
+
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrCannotFetchKeySet, ctx.Err())
+		}
+	}
+
+	if !r.attemptedAt.IsZero() && r.now().Sub(r.attemptedAt) < minJWKSRefreshInterval {
+		err := r.fetchErr
+		r.mu.Unlock()
+
+		return err
+	}
+
+	call := &keySetFetch{done: make(chan struct{})}
+	r.inflight = call
+	r.attemptedAt = r.now()
+	r.mu.Unlock()
+
+	keys, err := r.fetch(ctx)
+
+	r.mu.Lock()
+
+	if err == nil {
+		r.keys = keys
+		r.fetchedAt = r.now()
+	}
+
+	r.fetchErr = err
+	r.inflight = nil
+	r.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+
+	return err
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("%w: %w", ErrCannotFetchKeySet, err)
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("%w: %w", ErrCannotFetchKeySet, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return jose.JSONWebKeySet{}, fmt.Errorf("%w: unexpected status code %d", ErrCannotFetchKeySet, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxJWKSResponseSize))
+	if err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("%w: %w", ErrCannotFetchKeySet, err)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("%w: %w", ErrCannotFetchKeySet, err)
+	}
+
+	return keys, nil
+}
+
+func lookupKeys(keys jose.JSONWebKeySet, kid string) []jose.JSONWebKey {
+	if kid == "" {
+		return keys.Keys
+	}
+
+	return keys.Key(kid)
+}
@@ -0,0 +1,167 @@
+//go:build unit
+
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+)
+
+func TestRemoteKeySet_Keys(t *testing.T) {
+	t.Parallel()
+
+	key := newTestKey(t)
+
+	var requests atomic.Int32
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_ = json.NewEncoder(w).Encode(testKeySet(key))
+	}))
+	defer testServer.Close()
+
+	ks := auth.NewRemoteKeySet(testServer.URL, testServer.Client(), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		keys, err := ks.Keys(context.Background(), testKeyID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(keys) != 1 {
+			t.Fatalf("expected 1 key, got %d", len(keys))
+		}
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected the key set to be fetched once, got %d fetches", got)
+	}
+
+	if _, err := ks.Keys(context.Background(), "unknown"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected unknown key ids not to trigger a refetch right away, got %d fetches", got)
+	}
+}
+
+func TestRemoteKeySet_KeysConcurrentFetch(t *testing.T) {
+	t.Parallel()
+
+	key := newTestKey(t)
+
+	var requests atomic.Int32
+
+	release := make(chan struct{})
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_ = json.NewEncoder(w).Encode(testKeySet(key))
+	}))
+	defer testServer.Close()
+
+	ks := auth.NewRemoteKeySet(testServer.URL, testServer.Client(), time.Hour)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := ks.Keys(context.Background(), testKeyID); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected the concurrent callers to share the fetch, got %d fetches", got)
+	}
+}
+
+func TestRemoteKeySet_KeysUnavailable(t *testing.T) {
+	t.Parallel()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer testServer.Close()
+
+	ks := auth.NewRemoteKeySet(testServer.URL, testServer.Client(), time.Hour)
+
+	if _, err := ks.Keys(context.Background(), testKeyID); !errors.Is(err, auth.ErrCannotFetchKeySet) {
+		t.Errorf("expected error %v, got %v", auth.ErrCannotFetchKeySet, err)
+	}
+}
+
+func TestFileKeySet_Keys(t *testing.T) {
+	t.Parallel()
+
+	ks := auth.NewFileKeySet(writeTestKeySet(t, newTestKey(t)))
+
+	keys, err := ks.Keys(context.Background(), testKeyID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key, got %d", len(keys))
+	}
+
+	if _, err := auth.NewFileKeySet("/does/not/exist").Keys(context.Background(), testKeyID); !errors.Is(err, auth.ErrCannotReadKeySet) {
+		t.Errorf("expected error %v, got %v", auth.ErrCannotReadKeySet, err)
+	}
+}
+
+func TestFileKeySet_KeysThrottled(t *testing.T) {
+	t.Parallel()
+
+	path := writeTestKeySet(t, newTestKey(t))
+	ks := auth.NewFileKeySet(path)
+
+	if _, err := ks.Keys(context.Background(), "unknown"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Fatalf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("cannot remove key set: %v", err)
+	}
+
+	if _, err := ks.Keys(context.Background(), testKeyID); err != nil {
+		t.Errorf("expected the known key to be served from memory, got %v", err)
+	}
+
+	// The file is not read again right away, or the error would be about the missing file.
+	if _, err := ks.Keys(context.Background(), "unknown"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Errorf("expected error %v, got %v", auth.ErrKeyNotFound, err)
+	}
+}
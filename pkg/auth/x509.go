@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+var ErrMissingCommonName = errors.New("client certificate has no common name")
+
+// IdentityFromCertificate maps the subject of a verified client certificate to an identity, the same way
+// the apiserver does: the common name is the username and the organizations are the groups.
+func IdentityFromCertificate(cert *x509.Certificate) (*Identity, error) {
+	if cert.Subject.CommonName == "" {
+		return nil, ErrMissingCommonName
+	}
+
+	groups := make([]string, 0, len(cert.Subject.Organization)+1)
+	groups = append(groups, cert.Subject.Organization...)
+
+	return &Identity{
+		Username: cert.Subject.CommonName,
+		Groups:   append(groups, AuthenticatedGroup),
+		Method:   "x509",
+	}, nil
+}
@@ -0,0 +1,65 @@
+//go:build unit
+
+package auth_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+)
+
+func TestIdentityFromCertificate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc    string
+		subject pkix.Name
+		want    *auth.Identity
+		wantErr error
+	}{
+		{
+			desc:    "common name and organizations",
+			subject: pkix.Name{CommonName: "jane", Organization: []string{"devs", "ops"}},
+			want: &auth.Identity{
+				Username: "jane",
+				Groups:   []string{"devs", "ops", auth.AuthenticatedGroup},
+				Method:   "x509",
+			},
+		},
+		{
+			desc:    "common name only",
+			subject: pkix.Name{CommonName: "system:node:worker-1"},
+			want: &auth.Identity{
+				Username: "system:node:worker-1",
+				Groups:   []string{auth.AuthenticatedGroup},
+				Method:   "x509",
+			},
+		},
+		{
+			desc:    "missing common name",
+			subject: pkix.Name{Organization: []string{"devs"}},
+			wantErr: auth.ErrMissingCommonName,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := auth.IdentityFromCertificate(&x509.Certificate{Subject: tC.subject})
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if diff := cmp.Diff(tC.want, got); diff != "" {
+				t.Errorf("unexpected identity (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
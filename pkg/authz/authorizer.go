@@ -0,0 +1,141 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Decision is the outcome of the evaluation of the rules against a request.
+type Decision struct {
+	Allowed bool
+	// Rule is the name of the rule that matched the request, empty if none did.
+	Rule   string
+	Reason string
+}
+
+func NewAuthorizer(rules []config.AuthorizationRule) *Authorizer {
+	return &Authorizer{rules: rules}
+}
+
+// Authorizer evaluates declarative rules against the identity of the caller and the attributes of the request.
+type Authorizer struct {
+	rules []config.AuthorizationRule
+}
+
+// Authorize returns the decision of the first rule matching the request, denying it when no rule matches.
+func (a *Authorizer) Authorize(id *auth.Identity, ri *kube.RequestInfo) Decision {
+	if id == nil {
+		id = auth.Anonymous()
+	}
+
+	for _, rule := range a.rules {
+		if !matchesSubject(rule, id) || !matchesRequest(rule, ri) {
+			continue
+		}
+
+		if rule.Effect == EffectAllow {
+			return Decision{Allowed: true, Rule: rule.Name, Reason: fmt.Sprintf("allowed by rule %q", rule.Name)}
+		}
+
+		return Decision{
+			Allowed: false,
+			Rule:    rule.Name,
+			Reason:  fmt.Sprintf("user %q cannot %s: denied by rule %q", id.Username, describe(ri), rule.Name),
+		}
+	}
+
+	return Decision{
+		Allowed: false,
+		Reason:  fmt.Sprintf("user %q cannot %s: no rule allows it", id.Username, describe(ri)),
+	}
+}
+
+func matchesSubject(rule config.AuthorizationRule, id *auth.Identity) bool {
+	if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+		return true
+	}
+
+	if kube.MatchesAny(rule.Users, id.Username) {
+		return true
+	}
+
+	for _, g := range id.Groups {
+		if kube.MatchesAny(rule.Groups, g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesRequest(rule config.AuthorizationRule, ri *kube.RequestInfo) bool {
+	if !ri.IsResourceRequest {
+		resourceRule := len(rule.APIGroups) > 0 || len(rule.Resources) > 0 ||
+			len(rule.Namespaces) > 0 || len(rule.ResourceNames) > 0
+
+		return kube.MatchesOptional(rule.Verbs, ri.Verb) && !resourceRule &&
+			matchesNonResourceURL(rule.NonResourceURLs, ri.Path)
+	}
+
+	if len(rule.NonResourceURLs) > 0 {
+		return false
+	}
+
+	return ri.Matches(rule.Verbs, rule.APIGroups, rule.Resources) &&
+		kube.MatchesOptional(rule.Namespaces, ri.Namespace) &&
+		kube.MatchesOptional(rule.ResourceNames, ri.Name)
+}
+
+func matchesNonResourceURL(patterns []string, urlPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if p == kube.Wildcard || p == urlPath {
+			return true
+		}
+
+		if strings.HasSuffix(p, kube.Wildcard) && strings.HasPrefix(urlPath, strings.TrimSuffix(p, kube.Wildcard)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func describe(ri *kube.RequestInfo) string {
+	if !ri.IsResourceRequest {
+		return fmt.Sprintf("%s path %q", ri.Verb, ri.Path)
+	}
+
+	resource := ri.Resource
+	if ri.Subresource != "" {
+		resource += "/" + ri.Subresource
+	}
+
+	if ri.APIGroup != "" {
+		resource += "." + ri.APIGroup
+	}
+
+	desc := fmt.Sprintf("%s resource %q", ri.Verb, resource)
+
+	if ri.Name != "" {
+		desc += fmt.Sprintf(" named %q", ri.Name)
+	}
+
+	if ri.Namespace != "" {
+		desc += fmt.Sprintf(" in namespace %q", ri.Namespace)
+	}
+
+	return desc
+}
@@ -0,0 +1,174 @@
+//go:build unit
+
+package authz_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/authz"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	rules := []config.AuthorizationRule{
+		{
+			Name:       "no-secrets",
+			Effect:     authz.EffectDeny,
+			Resources:  []string{"secrets"},
+			Namespaces: []string{"kube-system"},
+		},
+		{
+			Name:      "admins",
+			Effect:    authz.EffectAllow,
+			Groups:    []string{"admins"},
+			Resources: []string{"*"},
+		},
+		{
+			Name:      "read-pods",
+			Effect:    authz.EffectAllow,
+			Users:     []string{"jane"},
+			Verbs:     []string{kube.VerbGet, kube.VerbList, kube.VerbWatch},
+			APIGroups: []string{""},
+			Resources: []string{"pods", "pods/log"},
+		},
+		{
+			Name:          "scale-web",
+			Effect:        authz.EffectAllow,
+			Users:         []string{"jane"},
+			Verbs:         []string{kube.VerbPatch},
+			APIGroups:     []string{"apps"},
+			Resources:     []string{"deployments/*"},
+			ResourceNames: []string{"web"},
+		},
+		{
+			Name:            "version",
+			Effect:          authz.EffectAllow,
+			NonResourceURLs: []string{"/version", "/apis/*"},
+		},
+	}
+
+	jane := &auth.Identity{Username: "jane", Groups: []string{auth.AuthenticatedGroup}}
+	admin := &auth.Identity{Username: "root", Groups: []string{"admins", auth.AuthenticatedGroup}}
+
+	testCases := []struct {
+		desc     string
+		id       *auth.Identity
+		method   string
+		url      string
+		wantOK   bool
+		wantRule string
+	}{
+		{
+			desc:     "allowed resource",
+			id:       jane,
+			method:   http.MethodGet,
+			url:      "/api/v1/namespaces/default/pods",
+			wantOK:   true,
+			wantRule: "read-pods",
+		},
+		{
+			desc:     "allowed subresource",
+			id:       jane,
+			method:   http.MethodGet,
+			url:      "/api/v1/namespaces/default/pods/web-0/log",
+			wantOK:   true,
+			wantRule: "read-pods",
+		},
+		{
+			desc:   "subresource not matched by its resource",
+			id:     jane,
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default/pods/web-0/exec",
+			wantOK: false,
+		},
+		{
+			desc:   "verb not allowed",
+			id:     jane,
+			method: http.MethodDelete,
+			url:    "/api/v1/namespaces/default/pods/web-0",
+			wantOK: false,
+		},
+		{
+			desc:     "wildcard subresource and resource name",
+			id:       jane,
+			method:   http.MethodPatch,
+			url:      "/apis/apps/v1/namespaces/default/deployments/web/scale",
+			wantOK:   true,
+			wantRule: "scale-web",
+		},
+		{
+			desc:   "other resource name",
+			id:     jane,
+			method: http.MethodPatch,
+			url:    "/apis/apps/v1/namespaces/default/deployments/api/scale",
+			wantOK: false,
+		},
+		{
+			desc:     "deny wins when first",
+			id:       admin,
+			method:   http.MethodGet,
+			url:      "/api/v1/namespaces/kube-system/secrets",
+			wantOK:   false,
+			wantRule: "no-secrets",
+		},
+		{
+			desc:     "group allowed",
+			id:       admin,
+			method:   http.MethodGet,
+			url:      "/api/v1/namespaces/default/secrets",
+			wantOK:   true,
+			wantRule: "admins",
+		},
+		{
+			desc:     "non-resource url",
+			id:       nil,
+			method:   http.MethodGet,
+			url:      "/version",
+			wantOK:   true,
+			wantRule: "version",
+		},
+		{
+			desc:     "non-resource url prefix",
+			id:       auth.Anonymous(),
+			method:   http.MethodGet,
+			url:      "/apis/apps/v1",
+			wantOK:   true,
+			wantRule: "version",
+		},
+		{
+			desc:   "anonymous resource request",
+			id:     auth.Anonymous(),
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default/pods",
+			wantOK: false,
+		},
+	}
+
+	authorizer := authz.NewAuthorizer(rules)
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			ri := kube.ParseRequestInfo(httptest.NewRequest(tC.method, tC.url, nil))
+
+			got := authorizer.Authorize(tC.id, ri)
+
+			if got.Allowed != tC.wantOK {
+				t.Errorf("expected allowed to be %t, got %t: %s", tC.wantOK, got.Allowed, got.Reason)
+			}
+
+			if got.Rule != tC.wantRule {
+				t.Errorf("expected rule %q, got %q", tC.wantRule, got.Rule)
+			}
+		})
+	}
+}
@@ -1,11 +1,143 @@
 package config
 
+import "time"
+
 type Config struct {
-	Middlewares Middlewares `yaml:"middlewares"`
+	Middlewares   Middlewares   `yaml:"middlewares"`
+	Headers       Headers       `yaml:"headers,omitempty"`
+	Impersonation Impersonation `yaml:"impersonation,omitempty"`
+	Passthrough   Passthrough   `yaml:"passthrough,omitempty"`
+	Clusters      Clusters      `yaml:"clusters,omitempty"`
+	Cache         Cache         `yaml:"cache,omitempty"`
+	Transforms    Transforms    `yaml:"transforms,omitempty"`
+}
+
+// Transforms defines response transformations on the server side: clients select the Named ones with
+// the `transform` query parameter, while the Routes apply them by default to the matching requests.
+// DisableAdHoc rejects the programs supplied by the clients themselves, e.g. with the `jq` query parameter.
+// Ad-hoc go templates are rejected unless AllowAdHocTemplates is set.
+type Transforms struct {
+	DisableAdHoc        bool                 `yaml:"disableAdHoc,omitempty"`        //nolint:tagliatelle // valid tag
+	AllowAdHocTemplates bool                 `yaml:"allowAdHocTemplates,omitempty"` //nolint:tagliatelle // valid tag
+	Named               map[string]Transform `validate:"omitempty,dive,keys,required,endkeys,required" yaml:"named,omitempty"`
+	Routes              []TransformRoute     `validate:"omitempty,dive"                                yaml:"routes,omitempty"`
+}
+
+// Transform is a named response transformation, written in the language of exactly one of the transformers.
+// CELFilter drops the items of a list for which the CEL predicate is false, rather than replacing the response.
+// Output selects the output of the JSONPath templates, json by default or text as rendered by kubectl,
+// the content type of the go templates, text by default or json, and how the results of the jq programs
+// are written: json for a single result, array, ndjson, or raw for strings written like `jq -r` does.
+// The CEL expressions have no Output, and Validate rejects the ones their language does not support.
+type Transform struct {
+	JQ         string `validate:"omitempty"                                  yaml:"jq,omitempty"`
+	JSONPath   string `validate:"omitempty"                                  yaml:"jsonpath,omitempty"`
+	CEL        string `validate:"omitempty"                                  yaml:"cel,omitempty"`
+	CELFilter  string `validate:"omitempty"                                  yaml:"celFilter,omitempty"` //nolint:tagliatelle // valid tag
+	GoTemplate string `validate:"omitempty"                                  yaml:"gotemplate,omitempty"`
+	Output     string `validate:"omitempty,oneof=json text array ndjson raw" yaml:"output,omitempty"`
+}
+
+// Languages returns the number of languages the transform is written in, which must be exactly one.
+func (t Transform) Languages() int {
+	n := 0
+
+	for _, src := range []string{t.JQ, t.JSONPath, t.CEL, t.CELFilter, t.GoTemplate} {
+		if src != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// TransformRoute applies the named Transform to the responses of the requests matching all of its non-empty
+// fields, unless the client selects another transformation. Routes are evaluated in order, the first matching
+// one applies. Paths are glob patterns, as understood by path.Match, and resources follow the same RBAC
+// conventions as the AuthorizationRule ones.
+type TransformRoute struct {
+	Transform string   `validate:"required"                 yaml:"transform"`
+	Paths     []string `validate:"omitempty,dive,required"  yaml:"paths,omitempty"`
+	Verbs     []string `validate:"omitempty,dive,lowercase" yaml:"verbs,omitempty"`
+	APIGroups []string `validate:"omitempty"                yaml:"apiGroups,omitempty"` //nolint:tagliatelle // valid tag
+	Resources []string `validate:"omitempty,dive,required"  yaml:"resources,omitempty"`
+}
+
+// Cache serves the get and list requests of the listed resources from informers kept in sync by the proxy,
+// falling back to the apiserver for the requests it cannot answer. The informers use the credentials of the proxy,
+// so the cache cannot be enabled along with Impersonation or Passthrough.
+type Cache struct {
+	Enabled   bool             `yaml:"enabled"`
+	Resources []CachedResource `validate:"required_if=Enabled true,dive" yaml:"resources,omitempty"`
+}
+
+// CachedResource identifies a resource to cache. StaleReads also serves from the cache the requests that
+// do not set a resourceVersion, which ask for the most recent data: their response may lag behind the apiserver.
+type CachedResource struct {
+	Group      string `validate:"omitempty" yaml:"group,omitempty"`
+	Version    string `validate:"required"  yaml:"version"`
+	Resource   string `validate:"required"  yaml:"resource"`
+	StaleReads bool   `validate:"omitempty" yaml:"staleReads,omitempty"` //nolint:tagliatelle // valid tag
+}
+
+// Clusters lists the clusters served by the proxy, when more than one: requests select one of them
+// with the /clusters/{name} path prefix or with the Header, falling back to the Default one.
+// When the list is empty, the proxy serves the cluster of the kubeconfig given on the command line.
+type Clusters struct {
+	Default string    `validate:"omitempty"                  yaml:"default,omitempty"`
+	Header  string    `validate:"omitempty"                  yaml:"header,omitempty"`
+	List    []Cluster `validate:"omitempty,unique=Name,dive" yaml:"list,omitempty"`
+}
+
+// Cluster tells how to connect to a cluster: Kubeconfig defaults to the one given on the command line,
+// Context to its current context, while InCluster uses the service account of the proxy pod instead.
+type Cluster struct {
+	Name       string `validate:"required,hostname_rfc1123"        yaml:"name"`
+	Kubeconfig string `validate:"omitempty"                        yaml:"kubeconfig,omitempty"`
+	Context    string `validate:"omitempty"                        yaml:"context,omitempty"`
+	InCluster  bool   `validate:"excluded_with=Kubeconfig Context" yaml:"inCluster,omitempty"` //nolint:tagliatelle // valid tag
+}
+
+// Passthrough makes the proxy call the apiserver with the bearer token supplied by the caller,
+// rather than with its own credentials. It is mutually exclusive with Impersonation.
+// Along with the Authentication middleware, the tokens of the issuers it does not trust are passed through
+// as well, leaving their authentication to the apiserver.
+type Passthrough struct {
+	Enabled   bool          `yaml:"enabled"`
+	CacheSize int           `validate:"omitempty,gt=0" yaml:"cacheSize,omitempty"` //nolint:tagliatelle // valid tag
+	CacheTTL  time.Duration `validate:"omitempty,gt=0" yaml:"cacheTtl,omitempty"`  //nolint:tagliatelle // valid tag
+}
+
+// Impersonation makes the proxy call the apiserver on behalf of the authenticated caller, so that
+// Kubernetes RBAC is enforced per end user. Claims, when set, take precedence over the identity fields.
+type Impersonation struct {
+	Enabled        bool              `yaml:"enabled"`
+	UsernameClaim  string            `validate:"omitempty"                                       yaml:"usernameClaim,omitempty"`  //nolint:tagliatelle,lll // valid tag
+	GroupsClaim    string            `validate:"omitempty"                                       yaml:"groupsClaim,omitempty"`    //nolint:tagliatelle,lll // valid tag
+	UsernamePrefix string            `validate:"omitempty"                                       yaml:"usernamePrefix,omitempty"` //nolint:tagliatelle,lll // valid tag
+	GroupsPrefix   string            `validate:"omitempty"                                       yaml:"groupsPrefix,omitempty"`   //nolint:tagliatelle,lll // valid tag
+	ExtraClaims    map[string]string `validate:"omitempty,dive,keys,required,endkeys,required"   yaml:"extraClaims,omitempty"`    //nolint:tagliatelle,lll // valid tag
+	Anonymous      string            `validate:"omitempty,oneof=deny impersonate serviceAccount" yaml:"anonymous,omitempty"`
+}
+
+type Headers struct {
+	Request  HeaderPolicy `validate:"omitempty" yaml:"request,omitempty"`
+	Response HeaderPolicy `validate:"omitempty" yaml:"response,omitempty"`
+}
+
+// HeaderPolicy describes which headers are passed through the proxy: when Allow is empty a sensible default
+// allowlist is used, "*" allows every header, Deny always wins over Allow and Add sets static headers.
+type HeaderPolicy struct {
+	Allow []string          `validate:"omitempty,dive,required"              yaml:"allow,omitempty"`
+	Deny  []string          `validate:"omitempty,dive,required"              yaml:"deny,omitempty"`
+	Add   map[string]string `validate:"omitempty,dive,keys,required,endkeys" yaml:"add,omitempty"`
 }
 
 type Middlewares struct {
-	BodyFilter MiddlewareConfig[BodyFilterConfig] `validate:"omitempty" yaml:"bodyFilter,omitempty"` //nolint:tagliatelle,lll // valid tag
+	BodyFilter     MiddlewareConfig[BodyFilterConfig]       `validate:"omitempty" yaml:"bodyFilter,omitempty"`     //nolint:tagliatelle,lll // valid tag
+	Authentication MiddlewareConfig[JWTAuthenticatorConfig] `validate:"omitempty" yaml:"authentication,omitempty"` //nolint:lll // valid tag
+	Authorization  MiddlewareConfig[AuthorizationRule]      `validate:"omitempty" yaml:"authorization,omitempty"`  //nolint:lll // valid tag
+	RateLimit      MiddlewareConfig[RateLimitRule]          `validate:"omitempty" yaml:"rateLimit,omitempty"`      //nolint:tagliatelle,lll // valid tag
 }
 
 type MiddlewareConfig[T any] struct {
@@ -23,3 +155,53 @@ type BodyFilterConfigPaths struct {
 	Path string `validate:"required"          yaml:"path"`
 	Type string `validate:"oneof=glob prefix" yaml:"type"`
 }
+
+// JWTAuthenticatorConfig describes a trusted issuer of bearer tokens: the keys used to verify their signature
+// are fetched either from a JWKS endpoint or from a local file.
+type JWTAuthenticatorConfig struct {
+	Issuer           string        `validate:"required"                                                       yaml:"issuer"`
+	Audiences        []string      `validate:"required,gt=0,dive,required"                                    yaml:"audiences"`
+	JWKSURL          string        `validate:"required_without=JWKSFile,excluded_with=JWKSFile,omitempty,url" yaml:"jwksUrl,omitempty"`          //nolint:tagliatelle,lll // valid tag
+	JWKSFile         string        `validate:"required_without=JWKSURL"                                       yaml:"jwksFile,omitempty"`         //nolint:tagliatelle,lll // valid tag
+	JWKSRefresh      time.Duration `validate:"omitempty,gt=0"                                                 yaml:"jwksRefresh,omitempty"`      //nolint:tagliatelle,lll // valid tag
+	UsernameClaim    string        `validate:"omitempty"                                                      yaml:"usernameClaim,omitempty"`    //nolint:tagliatelle,lll // valid tag
+	GroupsClaim      string        `validate:"omitempty"                                                      yaml:"groupsClaim,omitempty"`      //nolint:tagliatelle,lll // valid tag
+	ExtraClaims      []string      `validate:"omitempty,dive,required"                                        yaml:"extraClaims,omitempty"`      //nolint:tagliatelle,lll // valid tag
+	AllowedClockSkew time.Duration `validate:"omitempty,gte=0"                                                yaml:"allowedClockSkew,omitempty"` //nolint:tagliatelle,lll // valid tag
+}
+
+// AuthorizationRule allows or denies the requests matching all of its non-empty fields: rules are evaluated
+// in order, the first matching one wins and requests matching no rule are denied.
+// Resources follow the RBAC conventions: "pods" does not match "pods/log", while "pods/*" and "*" do.
+// NonResourceURLs match exactly, or by prefix when ending with "*".
+type AuthorizationRule struct {
+	Name            string   `validate:"required"                 yaml:"name"`
+	Effect          string   `validate:"oneof=allow deny"         yaml:"effect"`
+	Users           []string `validate:"omitempty,dive,required"  yaml:"users,omitempty"`
+	Groups          []string `validate:"omitempty,dive,required"  yaml:"groups,omitempty"`
+	Verbs           []string `validate:"omitempty,dive,lowercase" yaml:"verbs,omitempty"`
+	APIGroups       []string `validate:"omitempty"                yaml:"apiGroups,omitempty"` //nolint:tagliatelle // valid tag
+	Resources       []string `validate:"omitempty,dive,required"  yaml:"resources,omitempty"`
+	Namespaces      []string `validate:"omitempty,dive,required"  yaml:"namespaces,omitempty"`
+	ResourceNames   []string `validate:"omitempty,dive,required"  yaml:"resourceNames,omitempty"`   //nolint:tagliatelle // valid tag
+	NonResourceURLs []string `validate:"omitempty,dive,required"  yaml:"nonResourceURLs,omitempty"` //nolint:tagliatelle // valid tag
+}
+
+// RateLimitRule limits the rate of the requests matching all of its non-empty fields with a token bucket per key,
+// refilled at QPS tokens per second and holding up to Burst tokens. Rules are evaluated in order, the first
+// matching one applies and requests matching no rule are not limited. Verbs, api groups and resources are matched
+// like the AuthorizationRule ones: api groups can be globs, and "pods" does not match "pods/log", while "pods/*"
+// and "*/log" do.
+// Keys are the username of the caller, its IP address or the value of the given header, such as an API key.
+// The IP address is read from the X-Forwarded-For header only when the request comes from a TrustedProxies CIDR.
+type RateLimitRule struct {
+	Name           string   `validate:"required"                 yaml:"name"`
+	Key            string   `validate:"oneof=user ip header"     yaml:"key"`
+	Header         string   `validate:"required_if=Key header"   yaml:"header,omitempty"`
+	Verbs          []string `validate:"omitempty,dive,lowercase" yaml:"verbs,omitempty"`
+	APIGroups      []string `validate:"omitempty"                yaml:"apiGroups,omitempty"` //nolint:tagliatelle // valid tag
+	Resources      []string `validate:"omitempty,dive,required"  yaml:"resources,omitempty"`
+	QPS            float64  `validate:"gt=0"                     yaml:"qps"`
+	Burst          int      `validate:"gt=0"                     yaml:"burst"`
+	TrustedProxies []string `validate:"omitempty,dive,cidr"      yaml:"trustedProxies,omitempty"` //nolint:tagliatelle,lll // valid tag
+}
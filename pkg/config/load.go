@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrCannotReadConfig  = errors.New("config read failed")
+	ErrCannotParseConfig = errors.New("config unmarshal failed")
+	ErrEmptyConfig       = errors.New("config file is empty")
+)
+
+// Load reads, parses and validates the config file at the given path.
+// A missing file yields the empty config, which leaves all the optional features disabled.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("%w: %w", ErrCannotReadConfig, err)
+	}
+
+	return parse(data)
+}
+
+// LoadRequired reads, parses and validates the config file at the given path like Load does, but fails
+// when the file is missing or has no content: it is meant for reloads, where an empty config would
+// silently disable all the features configured so far, authentication and authorization included.
+// An explicit empty document, such as `{}`, is still accepted.
+func LoadRequired(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %w", ErrCannotReadConfig, err)
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Config{}, fmt.Errorf("%w: %w", ErrCannotParseConfig, err)
+	}
+
+	if doc.Kind == 0 {
+		return Config{}, fmt.Errorf("%w: '%s'", ErrEmptyConfig, path)
+	}
+
+	return parse(data)
+}
+
+func parse(data []byte) (Config, error) {
+	var cfg Config
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%w: %w", ErrCannotParseConfig, err)
+	}
+
+	if err := Validate(cfg); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
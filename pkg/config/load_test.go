@@ -0,0 +1,145 @@
+//go:build unit
+
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("cannot write config: %v", err)
+		}
+
+		return path
+	}
+
+	testCases := []struct {
+		desc    string
+		path    string
+		want    bool
+		wantErr error
+	}{
+		{
+			desc: "missing file",
+			path: filepath.Join(dir, "missing.yaml"),
+		},
+		{
+			desc: "valid file",
+			path: write("valid.yaml", "passthrough:\n  enabled: true\n"),
+			want: true,
+		},
+		{
+			desc:    "malformed file",
+			path:    write("malformed.yaml", "passthrough: [\n"),
+			wantErr: config.ErrCannotParseConfig,
+		},
+		{
+			desc:    "invalid file",
+			path:    write("invalid.yaml", "passthrough:\n  enabled: true\nimpersonation:\n  enabled: true\n"),
+			wantErr: config.ErrConflictingCredentialModes,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := config.Load(tC.path)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if cfg.Passthrough.Enabled != tC.want {
+				t.Errorf("expected passthrough enabled to be %t, got %t", tC.want, cfg.Passthrough.Enabled)
+			}
+		})
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("cannot write config: %v", err)
+		}
+
+		return path
+	}
+
+	testCases := []struct {
+		desc    string
+		path    string
+		want    bool
+		wantErr error
+	}{
+		{
+			desc:    "missing file",
+			path:    filepath.Join(dir, "missing.yaml"),
+			wantErr: os.ErrNotExist,
+		},
+		{
+			desc:    "empty file",
+			path:    write("empty.yaml", ""),
+			wantErr: config.ErrEmptyConfig,
+		},
+		{
+			desc:    "comments only",
+			path:    write("comments.yaml", "# passthrough:\n#   enabled: true\n"),
+			wantErr: config.ErrEmptyConfig,
+		},
+		{
+			desc: "explicit empty document",
+			path: write("explicit.yaml", "{}\n"),
+		},
+		{
+			desc: "valid file",
+			path: write("valid.yaml", "passthrough:\n  enabled: true\n"),
+			want: true,
+		},
+		{
+			desc:    "malformed file",
+			path:    write("malformed.yaml", "passthrough: [\n"),
+			wantErr: config.ErrCannotParseConfig,
+		},
+		{
+			desc:    "invalid file",
+			path:    write("invalid.yaml", "passthrough:\n  enabled: true\nimpersonation:\n  enabled: true\n"),
+			wantErr: config.ErrConflictingCredentialModes,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := config.LoadRequired(tC.path)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if cfg.Passthrough.Enabled != tC.want {
+				t.Errorf("expected passthrough enabled to be %t, got %t", tC.want, cfg.Passthrough.Enabled)
+			}
+		})
+	}
+}
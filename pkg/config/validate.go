@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	ErrConflictingCredentialModes = errors.New("impersonation and passthrough cannot be enabled at the same time")
+	ErrUnknownDefaultCluster      = errors.New("default cluster is not in the list of clusters")
+	ErrCacheWithCallerCredentials = errors.New("the cache cannot be enabled along with impersonation or passthrough")
+	ErrUnknownTransform           = errors.New("transform route refers to an unknown transform")
+	ErrAmbiguousTransform         = errors.New("transform must be written in exactly one language")
+	ErrInvalidTransformOutput     = errors.New("transform output is not supported by its language")
+)
+
+// Validate checks the struct tags of the config, as well as the constraints spanning several sections.
+func Validate(cfg Config) error {
+	if err := validator.New().Struct(cfg); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	if cfg.Impersonation.Enabled && cfg.Passthrough.Enabled {
+		return fmt.Errorf("config validation failed: %w", ErrConflictingCredentialModes)
+	}
+
+	if cfg.Cache.Enabled && (cfg.Impersonation.Enabled || cfg.Passthrough.Enabled) {
+		return fmt.Errorf("config validation failed: %w", ErrCacheWithCallerCredentials)
+	}
+
+	if cfg.Clusters.Default != "" && !hasCluster(cfg.Clusters.List, cfg.Clusters.Default) {
+		return fmt.Errorf("config validation failed: %w: '%s'", ErrUnknownDefaultCluster, cfg.Clusters.Default)
+	}
+
+	for name, t := range cfg.Transforms.Named {
+		if t.Languages() != 1 {
+			return fmt.Errorf("config validation failed: %w: '%s'", ErrAmbiguousTransform, name)
+		}
+
+		if !validTransformOutput(t) {
+			return fmt.Errorf("config validation failed: %w: '%s' in '%s'", ErrInvalidTransformOutput, t.Output, name)
+		}
+	}
+
+	for _, route := range cfg.Transforms.Routes {
+		if _, ok := cfg.Transforms.Named[route.Transform]; !ok {
+			return fmt.Errorf("config validation failed: %w: '%s'", ErrUnknownTransform, route.Transform)
+		}
+	}
+
+	return nil
+}
+
+// validTransformOutput tells whether the output of the transform is one its language supports,
+// the CEL expressions having none.
+func validTransformOutput(t Transform) bool {
+	var outputs []string
+
+	switch {
+	case t.JQ != "":
+		outputs = []string{"json", "array", "ndjson", "raw"}
+	case t.JSONPath != "":
+		outputs = []string{"json", "text"}
+	case t.GoTemplate != "":
+		outputs = []string{"text", "json"}
+	}
+
+	if t.Output == "" {
+		return true
+	}
+
+	for _, o := range outputs {
+		if o == t.Output {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasCluster(clusters []Cluster, name string) bool {
+	for _, c := range clusters {
+		if c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,327 @@
+//go:build unit
+
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc    string
+		cfg     config.Config
+		wantErr bool
+		err     error
+	}{
+		{
+			desc:    "empty config",
+			cfg:     config.Config{},
+			wantErr: false,
+		},
+		{
+			desc: "enabled middleware without config",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					BodyFilter: config.MiddlewareConfig[config.BodyFilterConfig]{Enabled: true},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "jwt authenticator without keys",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					Authentication: config.MiddlewareConfig[config.JWTAuthenticatorConfig]{
+						Enabled: true,
+						Config: []config.JWTAuthenticatorConfig{
+							{Issuer: "https://issuer.test", Audiences: []string{"kasp"}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "jwt authenticator with both key sources",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					Authentication: config.MiddlewareConfig[config.JWTAuthenticatorConfig]{
+						Enabled: true,
+						Config: []config.JWTAuthenticatorConfig{
+							{
+								Issuer:    "https://issuer.test",
+								Audiences: []string{"kasp"},
+								JWKSURL:   "https://issuer.test/jwks",
+								JWKSFile:  "/etc/jwks.json",
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "valid jwt authenticator",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					Authentication: config.MiddlewareConfig[config.JWTAuthenticatorConfig]{
+						Enabled: true,
+						Config: []config.JWTAuthenticatorConfig{
+							{Issuer: "https://issuer.test", Audiences: []string{"kasp"}, JWKSURL: "https://issuer.test/jwks"},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "valid rate limit",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					RateLimit: config.MiddlewareConfig[config.RateLimitRule]{
+						Enabled: true,
+						Config: []config.RateLimitRule{
+							{Name: "per-ip", Key: "ip", QPS: 10, Burst: 20, TrustedProxies: []string{"10.0.0.0/8"}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "rate limit by header without header",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					RateLimit: config.MiddlewareConfig[config.RateLimitRule]{
+						Enabled: true,
+						Config:  []config.RateLimitRule{{Name: "api-keys", Key: "header", QPS: 10, Burst: 20}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "rate limit with invalid trusted proxies",
+			cfg: config.Config{
+				Middlewares: config.Middlewares{
+					RateLimit: config.MiddlewareConfig[config.RateLimitRule]{
+						Enabled: true,
+						Config: []config.RateLimitRule{
+							{Name: "per-ip", Key: "ip", QPS: 10, Burst: 20, TrustedProxies: []string{"10.0.0.1"}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "transform routes",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named:  map[string]config.Transform{"podNames": {JQ: "[.items[].metadata.name]"}},
+					Routes: []config.TransformRoute{{Transform: "podNames", Resources: []string{"pods"}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "transform in several languages",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {JQ: ".", JSONPath: "{.items}"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrAmbiguousTransform,
+		},
+		{
+			desc: "transform without language",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {Output: "text"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrAmbiguousTransform,
+		},
+		{
+			desc: "jsonpath transform with unknown output",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {JSONPath: "{.items}", Output: "yaml"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "gotemplate transform with jq output",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {GoTemplate: "{{ .kind }}", Output: "ndjson"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrInvalidTransformOutput,
+		},
+		{
+			desc: "jsonpath transform with jq output",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {JSONPath: "{.items}", Output: "raw"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrInvalidTransformOutput,
+		},
+		{
+			desc: "jq transform with text output",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {JQ: ".items", Output: "text"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrInvalidTransformOutput,
+		},
+		{
+			desc: "cel transform with output",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{"podNames": {CEL: "object.items", Output: "json"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrInvalidTransformOutput,
+		},
+		{
+			desc: "transforms with their outputs",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Named: map[string]config.Transform{
+						"jq":         {JQ: ".items[]", Output: "ndjson"},
+						"jsonpath":   {JSONPath: "{.items}", Output: "text"},
+						"gotemplate": {GoTemplate: "{{ .kind }}", Output: "json"},
+						"cel":        {CEL: "object.items"},
+					},
+				},
+			},
+		},
+		{
+			desc: "transform route to unknown transform",
+			cfg: config.Config{
+				Transforms: config.Transforms{
+					Routes: []config.TransformRoute{{Transform: "podNames"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrUnknownTransform,
+		},
+		{
+			desc: "invalid anonymous policy",
+			cfg: config.Config{
+				Impersonation: config.Impersonation{Enabled: true, Anonymous: "allow"},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "impersonation and passthrough",
+			cfg: config.Config{
+				Impersonation: config.Impersonation{Enabled: true},
+				Passthrough:   config.Passthrough{Enabled: true},
+			},
+			wantErr: true,
+			err:     config.ErrConflictingCredentialModes,
+		},
+		{
+			desc: "cache",
+			cfg: config.Config{
+				Cache: config.Cache{
+					Enabled:   true,
+					Resources: []config.CachedResource{{Version: "v1", Resource: "pods", StaleReads: true}},
+				},
+			},
+		},
+		{
+			desc: "cache without resources",
+			cfg: config.Config{
+				Cache: config.Cache{Enabled: true},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "cache and impersonation",
+			cfg: config.Config{
+				Cache: config.Cache{
+					Enabled:   true,
+					Resources: []config.CachedResource{{Version: "v1", Resource: "pods"}},
+				},
+				Impersonation: config.Impersonation{Enabled: true},
+			},
+			wantErr: true,
+			err:     config.ErrCacheWithCallerCredentials,
+		},
+		{
+			desc: "valid clusters",
+			cfg: config.Config{
+				Clusters: config.Clusters{
+					Default: "prod",
+					List: []config.Cluster{
+						{Name: "prod", Kubeconfig: "/etc/kube/prod", Context: "admin"},
+						{Name: "local", InCluster: true},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			desc: "duplicated cluster names",
+			cfg: config.Config{
+				Clusters: config.Clusters{
+					List: []config.Cluster{{Name: "prod"}, {Name: "prod", Context: "other"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "in cluster with a kubeconfig",
+			cfg: config.Config{
+				Clusters: config.Clusters{
+					List: []config.Cluster{{Name: "local", InCluster: true, Kubeconfig: "/etc/kube/local"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			desc: "unknown default cluster",
+			cfg: config.Config{
+				Clusters: config.Clusters{
+					Default: "dev",
+					List:    []config.Cluster{{Name: "prod"}},
+				},
+			},
+			wantErr: true,
+			err:     config.ErrUnknownDefaultCluster,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := config.Validate(tC.cfg)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tC.wantErr, err)
+			}
+
+			if tC.err != nil && !errors.Is(err, tC.err) {
+				t.Errorf("expected error %v, got %v", tC.err, err)
+			}
+		})
+	}
+}
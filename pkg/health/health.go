@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Check is a named probe contributing to the health of the proxy.
+type Check interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+func NewCheck(name string, fn func(ctx context.Context) error) Check {
+	return &check{name: name, fn: fn}
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c *check) Name() string {
+	return c.name
+}
+
+func (c *check) Check(ctx context.Context) error {
+	return c.fn(ctx)
+}
+
+// Ping always succeeds: it tells that the process is up and serving requests.
+var Ping = NewCheck("ping", func(context.Context) error { return nil })
+
+// NewHandler serves the outcome of the given checks, following the conventions of the apiserver's
+// /livez and /readyz endpoints: it answers "ok" when all the checks pass, and lists the result of every check
+// when one of them fails or the "verbose" query parameter is set. The reasons of the failures are only
+// disclosed in verbose mode, and the checks named by the "exclude" query parameters are skipped.
+// All the checks share the given timeout; a zero timeout means no timeout.
+func NewHandler(name string, timeout time.Duration, checks ...Check) http.Handler {
+	return &handler{name: name, timeout: timeout, checks: checks}
+}
+
+type handler struct {
+	name    string
+	timeout time.Duration
+	checks  []Check
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	query := r.URL.Query()
+	_, verbose := query["verbose"]
+	excluded := make(map[string]struct{}, len(query["exclude"]))
+
+	for _, name := range query["exclude"] {
+		excluded[name] = struct{}{}
+	}
+
+	var (
+		out    strings.Builder
+		failed bool
+	)
+
+	for _, c := range h.checks {
+		if _, ok := excluded[c.Name()]; ok {
+			fmt.Fprintf(&out, "[+]%s excluded: ok\n", c.Name())
+
+			continue
+		}
+
+		if err := c.Check(ctx); err != nil {
+			failed = true
+
+			if verbose {
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", c.Name(), err)
+			} else {
+				fmt.Fprintf(&out, "[-]%s failed: reason withheld\n", c.Name())
+			}
+
+			continue
+		}
+
+		fmt.Fprintf(&out, "[+]%s ok\n", c.Name())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		fmt.Fprintf(w, "%s%s check failed\n", out.String(), h.name)
+
+		return
+	}
+
+	if !verbose {
+		fmt.Fprint(w, "ok")
+
+		return
+	}
+
+	fmt.Fprintf(w, "%s%s check passed\n", out.String(), h.name)
+}
@@ -0,0 +1,99 @@
+//go:build unit
+
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/health"
+)
+
+var errBroken = errors.New("broken")
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	failing := health.NewCheck("apiserver", func(context.Context) error { return errBroken })
+
+	testCases := []struct {
+		desc           string
+		checks         []health.Check
+		query          string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			desc:           "passing",
+			checks:         []health.Check{health.Ping},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "ok",
+		},
+		{
+			desc:           "passing verbose",
+			checks:         []health.Check{health.Ping},
+			query:          "?verbose",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "[+]ping ok\nreadyz check passed\n",
+		},
+		{
+			desc:           "failing",
+			checks:         []health.Check{health.Ping, failing},
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       "[+]ping ok\n[-]apiserver failed: reason withheld\nreadyz check failed\n",
+		},
+		{
+			desc:           "failing verbose",
+			checks:         []health.Check{health.Ping, failing},
+			query:          "?verbose",
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       "[+]ping ok\n[-]apiserver failed: broken\nreadyz check failed\n",
+		},
+		{
+			desc:           "failing excluded",
+			checks:         []health.Check{health.Ping, failing},
+			query:          "?verbose&exclude=apiserver",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "[+]ping ok\n[+]apiserver excluded: ok\nreadyz check passed\n",
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+
+			health.NewHandler("readyz", 0, tC.checks...).
+				ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz"+tC.query, nil))
+
+			assert.Equal(t, tC.wantStatusCode, w.Code)
+			assert.Equal(t, tC.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	t.Parallel()
+
+	slow := health.NewCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	})
+
+	w := httptest.NewRecorder()
+
+	health.NewHandler("readyz", 10*time.Millisecond, slow).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "[-]slow failed: context deadline exceeded")
+}
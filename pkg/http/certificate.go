@@ -0,0 +1,112 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	ErrCannotLoadCertificate = errors.New("cannot load tls certificate")
+	ErrCannotLoadClientCA    = errors.New("cannot load client ca bundle")
+)
+
+// NewCertificateReloader loads the key pair found in the given files, failing if it is not valid.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	c := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// CertificateReloader serves the key pair it last loaded to the tls handshakes, so that renewed certificates
+// are picked up by calling Reload, without restarting the server.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// Reload loads the key pair again, leaving the current one in place if the new one is not valid:
+// this is also the case while a renewal has replaced only one of the two files.
+func (c *CertificateReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotLoadCertificate, err)
+	}
+
+	c.cert.Store(&cert)
+
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Files returns the paths of the certificate and the key.
+func (c *CertificateReloader) Files() []string {
+	return []string{c.certFile, c.keyFile}
+}
+
+// NewCertPoolReloader loads the ca bundle found in the given file, failing if it holds no certificate.
+func NewCertPoolReloader(file string) (*CertPoolReloader, error) {
+	c := &CertPoolReloader{file: file}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// CertPoolReloader keeps the ca bundle it last loaded, so that rotated cas are picked up by calling Reload,
+// without restarting the server.
+type CertPoolReloader struct {
+	file string
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// Reload loads the ca bundle again, leaving the current one in place if the new one is not valid.
+func (c *CertPoolReloader) Reload() error {
+	pool, err := LoadCertPool(c.file)
+	if err != nil {
+		return err
+	}
+
+	c.pool.Store(pool)
+
+	return nil
+}
+
+// Pool returns the ca bundle last loaded.
+func (c *CertPoolReloader) Pool() *x509.CertPool {
+	return c.pool.Load()
+}
+
+// Files returns the path of the ca bundle.
+func (c *CertPoolReloader) Files() []string {
+	return []string{c.file}
+}
+
+// LoadCertPool reads the pem encoded certificates of a ca bundle.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotLoadClientCA, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no certificate found in '%s'", ErrCannotLoadClientCA, file)
+	}
+
+	return pool, nil
+}
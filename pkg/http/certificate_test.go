@@ -0,0 +1,184 @@
+//go:build unit
+
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+func TestCertificateReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeKeyPair(t, certFile, keyFile, "first")
+
+	certs, err := httpx.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertServedCommonName(t, certs, "first")
+
+	writeKeyPair(t, certFile, keyFile, "second")
+
+	if err := certs.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertServedCommonName(t, certs, "second")
+
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("cannot write key: %v", err)
+	}
+
+	if err := certs.Reload(); !errors.Is(err, httpx.ErrCannotLoadCertificate) {
+		t.Errorf("expected error %v, got %v", httpx.ErrCannotLoadCertificate, err)
+	}
+
+	assertServedCommonName(t, certs, "second")
+}
+
+func TestNewCertificateReloaderMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	_, err := httpx.NewCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if !errors.Is(err, httpx.ErrCannotLoadCertificate) {
+		t.Errorf("expected error %v, got %v", httpx.ErrCannotLoadCertificate, err)
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca.crt")
+
+	writeKeyPair(t, certFile, filepath.Join(dir, "ca.key"), "ca")
+
+	if _, err := httpx.LoadCertPool(certFile); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("cannot write ca: %v", err)
+	}
+
+	if _, err := httpx.LoadCertPool(certFile); !errors.Is(err, httpx.ErrCannotLoadClientCA) {
+		t.Errorf("expected error %v, got %v", httpx.ErrCannotLoadClientCA, err)
+	}
+}
+
+func TestCertPoolReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+
+	writeKeyPair(t, caFile, filepath.Join(dir, "ca.key"), "first")
+
+	cas, err := httpx.NewCertPoolReloader(caFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := cas.Pool()
+
+	writeKeyPair(t, caFile, filepath.Join(dir, "ca.key"), "second")
+
+	if err := cas.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := httpx.LoadCertPool(caFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cas.Pool().Equal(first) || !cas.Pool().Equal(second) {
+		t.Error("expected the second ca bundle to be served")
+	}
+
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("cannot write ca: %v", err)
+	}
+
+	if err := cas.Reload(); !errors.Is(err, httpx.ErrCannotLoadClientCA) {
+		t.Errorf("expected error %v, got %v", httpx.ErrCannotLoadClientCA, err)
+	}
+
+	if !cas.Pool().Equal(second) {
+		t.Error("expected the second ca bundle to be kept")
+	}
+}
+
+func assertServedCommonName(t *testing.T, certs *httpx.CertificateReloader, want string) {
+	t.Helper()
+
+	cert, err := certs.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("cannot parse certificate: %v", err)
+	}
+
+	if leaf.Subject.CommonName != want {
+		t.Errorf("expected the certificate of %q to be served, got %q", want, leaf.Subject.CommonName)
+	}
+}
+
+func writeKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("cannot write certificate: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("cannot write key: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var ErrInvalidCIDR = errors.New("invalid CIDR")
+
+// ParseCIDRs parses the given list of CIDRs, as found in the trusted proxies of the config.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCIDR, err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// ClientIP returns the address of the client that sent the request. When the request comes from a trusted proxy,
+// the X-Forwarded-For hops are walked from the closest one, and the first one not belonging to a trusted proxy
+// is returned: the hops on its left could have been forged by the client itself.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	hops := make([]string, 0)
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = hops[i]
+
+		if !isTrusted(ip, trusted) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
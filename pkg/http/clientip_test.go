@@ -0,0 +1,89 @@
+//go:build unit
+
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := httpx.ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{
+			desc:       "direct client",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "192.0.2.1",
+		},
+		{
+			desc:       "forwarded header from untrusted client",
+			remoteAddr: "192.0.2.1:1234",
+			xff:        []string{"198.51.100.7"},
+			want:       "192.0.2.1",
+		},
+		{
+			desc:       "trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"198.51.100.7"},
+			want:       "198.51.100.7",
+		},
+		{
+			desc:       "forged hops are skipped",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.9, 198.51.100.7", "10.0.0.2"},
+			want:       "198.51.100.7",
+		},
+		{
+			desc:       "trusted hops only",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			desc:       "trusted proxy without forwarded header",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/api", nil)
+			req.RemoteAddr = tC.remoteAddr
+
+			for _, v := range tC.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := httpx.ClientIP(req, trusted); got != tC.want {
+				t.Errorf("expected %q, got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	t.Parallel()
+
+	if _, err := httpx.ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error, got none")
+	}
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const wildcardHeader = "*"
+
+var (
+	// DefaultRequestHeaders are the headers forwarded to the apiserver when no allowlist is configured.
+	DefaultRequestHeaders = []string{
+		"Content-Type",
+	}
+
+	// DefaultResponseHeaders are the headers passed back to the client when no allowlist is configured.
+	DefaultResponseHeaders = []string{
+		"Audit-Id",
+		"Cache-Control",
+		"Content-Type",
+		"Etag",
+		"Expires",
+		"Last-Modified",
+		"Retry-After",
+		"Warning",
+		"X-Kubernetes-Pf-Flowschema-Uid",
+		"X-Kubernetes-Pf-Prioritylevel-Uid",
+	}
+
+	// requestHeadersBlocklist contains headers that are never forwarded to the apiserver, regardless of the policy,
+	// as they would either break the connection handling or override the credentials of the proxy.
+	requestHeadersBlocklist = []string{
+		"Authorization",
+		"Connection",
+		"Content-Length",
+		"Host",
+		"Impersonate-Group",
+		"Impersonate-Uid",
+		"Impersonate-User",
+		"Keep-Alive",
+		"Proxy-Authorization",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+
+	// requestHeaderPrefixesBlocklist contains the prefixes of the headers that are never forwarded to the apiserver,
+	// regardless of the policy, as they would add arbitrary extra fields to the impersonated user.
+	requestHeaderPrefixesBlocklist = []string{
+		"Impersonate-Extra-",
+	}
+
+	// responseHeadersBlocklist contains headers that are never passed back to the client, regardless of the policy,
+	// as the body might be rewritten by the transformers and the connection is handled by the proxy itself.
+	responseHeadersBlocklist = []string{
+		"Connection",
+		"Content-Length",
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+)
+
+func NewRequestHeaderPolicy(conf config.HeaderPolicy) HeaderPolicy {
+	hp := newHeaderPolicy(conf, DefaultRequestHeaders, requestHeadersBlocklist)
+
+	for _, p := range requestHeaderPrefixesBlocklist {
+		hp.denyPrefixes = append(hp.denyPrefixes, http.CanonicalHeaderKey(p))
+	}
+
+	return hp
+}
+
+func NewResponseHeaderPolicy(conf config.HeaderPolicy) HeaderPolicy {
+	return newHeaderPolicy(conf, DefaultResponseHeaders, responseHeadersBlocklist)
+}
+
+func newHeaderPolicy(conf config.HeaderPolicy, defaultAllow, blocklist []string) HeaderPolicy {
+	allow := conf.Allow
+	if len(allow) == 0 {
+		allow = defaultAllow
+	}
+
+	hp := HeaderPolicy{
+		allow: make(map[string]struct{}, len(allow)),
+		deny:  make(map[string]struct{}, len(conf.Deny)+len(blocklist)),
+		add:   make(http.Header, len(conf.Add)),
+	}
+
+	for _, h := range allow {
+		if h == wildcardHeader {
+			hp.allowAll = true
+
+			continue
+		}
+
+		hp.allow[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	for _, h := range blocklist {
+		hp.deny[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	for _, h := range conf.Deny {
+		hp.deny[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	for k, v := range conf.Add {
+		hp.add.Set(k, v)
+	}
+
+	return hp
+}
+
+// HeaderPolicy filters the headers flowing through the proxy, in either direction.
+type HeaderPolicy struct {
+	allowAll     bool
+	allow        map[string]struct{}
+	deny         map[string]struct{}
+	denyPrefixes []string
+	add          http.Header
+}
+
+// Allows tells whether the given header can be copied.
+func (hp HeaderPolicy) Allows(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+
+	if _, ok := hp.deny[name]; ok {
+		return false
+	}
+
+	for _, p := range hp.denyPrefixes {
+		if strings.HasPrefix(name, p) {
+			return false
+		}
+	}
+
+	if hp.allowAll {
+		return true
+	}
+
+	_, ok := hp.allow[name]
+
+	return ok
+}
+
+// Filter returns the subset of src allowed by the policy, plus the static headers.
+func (hp HeaderPolicy) Filter(src http.Header) http.Header {
+	dst := make(http.Header, len(src)+len(hp.add))
+
+	for k, vv := range src {
+		if !hp.Allows(k) {
+			continue
+		}
+
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+
+	for k, vv := range hp.add {
+		dst[k] = append([]string(nil), vv...)
+	}
+
+	return dst
+}
+
+// Apply copies the headers allowed by the policy from src to dst, then it sets the static ones.
+func (hp HeaderPolicy) Apply(dst, src http.Header) {
+	for k, vv := range hp.Filter(src) {
+		dst[k] = vv
+	}
+}
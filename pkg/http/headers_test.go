@@ -0,0 +1,115 @@
+//go:build unit
+
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+func TestHeaderPolicy_Filter(t *testing.T) {
+	t.Parallel()
+
+	src := http.Header{
+		"Audit-Id":                 []string{"1234"},
+		"Authorization":            []string{"Bearer secret"},
+		"Content-Length":           []string{"42"},
+		"Content-Type":             []string{"application/json"},
+		"Impersonate-Extra-Scopes": []string{"admin"},
+		"Warning":                  []string{`299 - "deprecated"`, `299 - "unknown field"`},
+		"X-Custom":                 []string{"custom"},
+	}
+
+	testCases := []struct {
+		desc   string
+		policy httpx.HeaderPolicy
+		want   http.Header
+	}{
+		{
+			desc:   "default request policy",
+			policy: httpx.NewRequestHeaderPolicy(config.HeaderPolicy{}),
+			want: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+		},
+		{
+			desc:   "default response policy",
+			policy: httpx.NewResponseHeaderPolicy(config.HeaderPolicy{}),
+			want: http.Header{
+				"Audit-Id":     []string{"1234"},
+				"Content-Type": []string{"application/json"},
+				"Warning":      []string{`299 - "deprecated"`, `299 - "unknown field"`},
+			},
+		},
+		{
+			desc: "custom allowlist, denylist and additions",
+			policy: httpx.NewResponseHeaderPolicy(config.HeaderPolicy{
+				Allow: []string{"content-type", "x-custom", "warning"},
+				Deny:  []string{"Warning"},
+				Add:   map[string]string{"x-served-by": "kube-apiserver-proxy"},
+			}),
+			want: http.Header{
+				"Content-Type": []string{"application/json"},
+				"X-Custom":     []string{"custom"},
+				"X-Served-By":  []string{"kube-apiserver-proxy"},
+			},
+		},
+		{
+			desc: "wildcard request allowlist never forwards credentials",
+			policy: httpx.NewRequestHeaderPolicy(config.HeaderPolicy{
+				Allow: []string{"*"},
+			}),
+			want: http.Header{
+				"Audit-Id":     []string{"1234"},
+				"Content-Type": []string{"application/json"},
+				"Warning":      []string{`299 - "deprecated"`, `299 - "unknown field"`},
+				"X-Custom":     []string{"custom"},
+			},
+		},
+		{
+			desc: "explicit request allowlist never forwards impersonation extras",
+			policy: httpx.NewRequestHeaderPolicy(config.HeaderPolicy{
+				Allow: []string{"impersonate-extra-scopes", "x-custom"},
+			}),
+			want: http.Header{
+				"X-Custom": []string{"custom"},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tC.want, tC.policy.Filter(src)); diff != "" {
+				t.Errorf("Filter() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHeaderPolicy_Apply(t *testing.T) {
+	t.Parallel()
+
+	policy := httpx.NewResponseHeaderPolicy(config.HeaderPolicy{})
+
+	dst := http.Header{"Access-Control-Allow-Origin": []string{"*"}}
+	src := http.Header{"Content-Type": []string{"application/json"}, "Content-Length": []string{"42"}}
+
+	policy.Apply(dst, src)
+
+	want := http.Header{
+		"Access-Control-Allow-Origin": []string{"*"},
+		"Content-Type":                []string{"application/json"},
+	}
+
+	if diff := cmp.Diff(want, dst); diff != "" {
+		t.Errorf("Apply() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+type accessLogEntryKey struct{}
+
+// accessLogEntry collects the data that the downstream middlewares find out while serving the request,
+// such as the identity of the caller, which the access log needs once the response has been written.
+type accessLogEntry struct {
+	identity *auth.Identity
+}
+
+func setAccessLogIdentity(ctx context.Context, id *auth.Identity) {
+	if e, ok := ctx.Value(accessLogEntryKey{}).(*accessLogEntry); ok {
+		e.identity = id
+	}
+}
+
+func AccessLogMux(logger *slog.Logger) kaspHttp.MuxMiddleware {
+	return func(next http.Handler) http.Handler {
+		return AccessLog(next, logger)
+	}
+}
+
+// AccessLog writes a log line for every request served, recording the caller identity, the request info
+// of the apiserver, the status code, the size of the response and the time taken to serve it.
+// Neither the bodies nor the headers are logged.
+func AccessLog(next http.Handler, logger *slog.Logger) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		start := time.Now()
+		rec := kaspHttp.NewStatusRecorder(w)
+		ri := kube.RequestInfoFor(r)
+		entry := &accessLogEntry{}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogEntryKey{}, entry)))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"verb", ri.Verb,
+			"apiGroup", ri.APIGroup,
+			"resource", ri.Resource,
+			"subresource", ri.Subresource,
+			"namespace", ri.Namespace,
+			"name", ri.Name,
+			"user", username(entry.identity),
+			"status", rec.Code(),
+			"bytes", rec.Size(),
+			"duration", time.Since(start),
+		}
+
+		if cluster, ok := kube.ClusterFrom(r.Context()); ok {
+			attrs = append(attrs, "cluster", cluster)
+		}
+
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			attrs = append(attrs, "traceID", sc.TraceID().String())
+		}
+
+		logger.Log(r.Context(), slog.LevelInfo, "request served", attrs...)
+	})
+}
+
+func username(id *auth.Identity) string {
+	if id == nil {
+		return auth.AnonymousUser
+	}
+
+	return id.Username
+}
@@ -0,0 +1,57 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+	"github.com/omissis/kube-apiserver-proxy/pkg/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	if err != nil {
+		t.Fatalf("cannot create logger: %v", err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"kind":"Secret","data":{"password":"aHVudGVyMg=="}}`))
+	})
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/namespaces/default/secrets",
+		strings.NewReader(`{"kind":"Secret","data":{"password":"aHVudGVyMg=="}}`),
+	)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+
+	middleware.AccessLogMux(logger)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("cannot decode log line %q: %v", buf.String(), err)
+	}
+
+	assert.Equal(t, slog.LevelInfo.String(), line["level"])
+	assert.Equal(t, "request served", line["msg"])
+	assert.Equal(t, "create", line["verb"])
+	assert.Equal(t, "secrets", line["resource"])
+	assert.Equal(t, "default", line["namespace"])
+	assert.Equal(t, "system:anonymous", line["user"])
+	assert.Equal(t, float64(http.StatusCreated), line["status"])
+	assert.Equal(t, float64(52), line["bytes"])
+	assert.NotContains(t, buf.String(), "s3cr3t")
+	assert.NotContains(t, buf.String(), "aHVudGVyMg==")
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+var ErrUnknownIssuer = errors.New("token was not issued by any trusted issuer")
+
+func AuthenticationMux(conf []config.JWTAuthenticatorConfig, passthroughUnknownIssuers bool) kaspHttp.MuxMiddleware {
+	authenticators := make([]*auth.JWTAuthenticator, 0, len(conf))
+
+	for _, c := range conf {
+		authenticators = append(authenticators, auth.NewJWTAuthenticatorFromConfig(c))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return Authentication(next, authenticators, passthroughUnknownIssuers)
+	}
+}
+
+// Authentication verifies the bearer token of the request, if any, against the trusted issuers
+// and stores the resulting identity in the request context.
+// Requests without a bearer token are passed through as they are, leaving to the downstream
+// middlewares the decision on how to deal with anonymous requests.
+// When passthroughUnknownIssuers is set, the tokens of the issuers the proxy does not trust, such as
+// the service account ones, are passed through the same way, for the apiserver to authenticate them.
+func Authentication(
+	next http.Handler,
+	authenticators []*auth.JWTAuthenticator,
+	passthroughUnknownIssuers bool,
+) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			slog.Warn("empty request")
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
+
+			return
+		}
+
+		token, ok := auth.BearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		id, err := authenticate(r, token, authenticators)
+		if passthroughUnknownIssuers && errors.Is(err, ErrUnknownIssuer) {
+			slog.Debug("request token passed through", "path", r.URL.Path)
+
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if err != nil {
+			slog.Info("cannot authenticate request", "error", err, "path", r.URL.Path)
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-apiserver-proxy"`)
+
+			kube.WriteStatus(w, apierrors.NewUnauthorized("invalid bearer token").Status())
+
+			return
+		}
+
+		slog.Debug("request authenticated", "username", id.Username, "groups", id.Groups)
+
+		setAccessLogIdentity(r.Context(), id)
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+func authenticate(r *http.Request, token string, authenticators []*auth.JWTAuthenticator) (*auth.Identity, error) {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", auth.ErrInvalidToken, err)
+	}
+
+	// The issuer is read before verifying the signature only to pick the authenticator in charge of the token.
+	var unverified jwt.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, fmt.Errorf("%w: %w", auth.ErrInvalidToken, err)
+	}
+
+	for _, a := range authenticators {
+		if a.Issuer() == unverified.Issuer {
+			return a.Authenticate(r.Context(), token)
+		}
+	}
+
+	return nil, ErrUnknownIssuer
+}
@@ -0,0 +1,155 @@
+package middleware_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+)
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "k1", Algorithm: string(jose.RS256), Use: "sig"}},
+	})
+	if err != nil {
+		t.Fatalf("cannot marshal key set: %v", err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatalf("cannot write key set: %v", err)
+	}
+
+	conf := []config.JWTAuthenticatorConfig{
+		{
+			Issuer:    "https://issuer.kube-apiserver-proxy.test",
+			Audiences: []string{"kube-apiserver-proxy"},
+			JWKSFile:  jwksFile,
+		},
+	}
+
+	sign := func(issuer string) string {
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "k1"}},
+			(&jose.SignerOptions{}).WithType("JWT"),
+		)
+		if err != nil {
+			t.Fatalf("cannot create signer: %v", err)
+		}
+
+		token, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   issuer,
+			Subject:  "jane",
+			Audience: jwt.Audience{"kube-apiserver-proxy"},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).CompactSerialize()
+		if err != nil {
+			t.Fatalf("cannot sign token: %v", err)
+		}
+
+		return token
+	}
+
+	testCases := []struct {
+		desc           string
+		authorization  string
+		passthrough    bool
+		wantStatusCode int
+		wantUsername   string
+	}{
+		{
+			desc:           "no token",
+			authorization:  "",
+			wantStatusCode: http.StatusOK,
+			wantUsername:   "",
+		},
+		{
+			desc:           "valid token",
+			authorization:  "Bearer " + sign("https://issuer.kube-apiserver-proxy.test"),
+			wantStatusCode: http.StatusOK,
+			wantUsername:   "jane",
+		},
+		{
+			desc:           "untrusted issuer",
+			authorization:  "Bearer " + sign("https://evil.test"),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "untrusted issuer with passthrough",
+			authorization:  "Bearer " + sign("https://kubernetes.default.svc"),
+			passthrough:    true,
+			wantStatusCode: http.StatusOK,
+			wantUsername:   "",
+		},
+		{
+			desc:           "invalid token of a trusted issuer with passthrough",
+			authorization:  "Bearer " + sign("https://issuer.kube-apiserver-proxy.test") + "x",
+			passthrough:    true,
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			desc:           "malformed token",
+			authorization:  "Bearer not-a-token",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				username string
+				log      bytes.Buffer
+			)
+
+			handler := middleware.AuthenticationMux(conf, tC.passthrough)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if id, ok := auth.IdentityFrom(r.Context()); ok {
+					username = id.Username
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			handler = middleware.AccessLogMux(slog.New(slog.NewJSONHandler(&log, nil)))(handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+			if tC.authorization != "" {
+				req.Header.Set("Authorization", tC.authorization)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tC.wantStatusCode, w.Code)
+			assert.Equal(t, tC.wantUsername, username)
+
+			if tC.wantUsername != "" {
+				assert.Contains(t, log.String(), `"user":"`+tC.wantUsername+`"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/authz"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func AuthorizationMux(rules []config.AuthorizationRule) kaspHttp.MuxMiddleware {
+	authorizer := authz.NewAuthorizer(rules)
+
+	return func(next http.Handler) http.Handler {
+		return Authorization(next, authorizer)
+	}
+}
+
+// Authorization evaluates the rules of the authorizer against the identity stored in the request context
+// by the Authentication middleware, treating requests without one as anonymous, and rejects the denied
+// ones with a 403 status explaining which rule denied them.
+func Authorization(next http.Handler, authorizer *authz.Authorizer) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			slog.Warn("empty request")
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
+
+			return
+		}
+
+		id, ok := auth.IdentityFrom(r.Context())
+		if !ok {
+			id = auth.Anonymous()
+		}
+
+		ri := kube.RequestInfoFor(r)
+
+		decision := authorizer.Authorize(id, ri)
+		if !decision.Allowed {
+			slog.Info("request denied", "username", id.Username, "rule", decision.Rule, "path", r.URL.Path)
+
+			kube.WriteStatus(w, apierrors.NewForbidden(
+				schema.GroupResource{Group: ri.APIGroup, Resource: ri.Resource},
+				ri.Name,
+				errors.New(decision.Reason), //nolint:goerr113 // dynamic reason
+			).Status())
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+)
+
+func TestAuthorization(t *testing.T) {
+	t.Parallel()
+
+	rules := []config.AuthorizationRule{
+		{
+			Name:      "no-delete",
+			Effect:    "deny",
+			Verbs:     []string{"delete"},
+			Resources: []string{"*"},
+		},
+		{
+			Name:   "jane",
+			Effect: "allow",
+			Users:  []string{"jane"},
+		},
+	}
+
+	testCases := []struct {
+		desc           string
+		id             *auth.Identity
+		method         string
+		wantStatusCode int
+		wantRule       string
+	}{
+		{
+			desc:           "allowed",
+			id:             &auth.Identity{Username: "jane"},
+			method:         http.MethodGet,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "denied by rule",
+			id:             &auth.Identity{Username: "jane"},
+			method:         http.MethodDelete,
+			wantStatusCode: http.StatusForbidden,
+			wantRule:       "no-delete",
+		},
+		{
+			desc:           "anonymous",
+			method:         http.MethodGet,
+			wantStatusCode: http.StatusForbidden,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.AuthorizationMux(rules)(next)
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tC.method, "/api/v1/namespaces/default/pods/web-0", nil)
+			if tC.id != nil {
+				req = req.WithContext(auth.WithIdentity(req.Context(), tC.id))
+			}
+
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tC.wantStatusCode {
+				t.Fatalf("expected status code %d, got %d", tC.wantStatusCode, rec.Code)
+			}
+
+			if tC.wantStatusCode == http.StatusOK {
+				return
+			}
+
+			var status metav1.Status
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatalf("cannot decode status: %v", err)
+			}
+
+			if status.Reason != metav1.StatusReasonForbidden {
+				t.Errorf("expected reason %q, got %q", metav1.StatusReasonForbidden, status.Reason)
+			}
+
+			if tC.wantRule != "" && !strings.Contains(status.Message, tC.wantRule) {
+				t.Errorf("expected message to name rule %q, got %q", tC.wantRule, status.Message)
+			}
+		})
+	}
+}
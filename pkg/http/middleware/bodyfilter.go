@@ -12,12 +12,18 @@ import (
 
 	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/omissis/kube-apiserver-proxy/pkg/config"
 	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
 )
 
-var ErrDuringBodyFilter = errors.New("error during body filter")
+var (
+	ErrDuringBodyFilter = errors.New("error during body filter")
+	ErrBodyFilterFailed = errors.New("cannot filter request body")
+)
 
 func BodyFilterMux(conf []config.BodyFilterConfig) kaspHttp.MuxMiddleware {
 	return func(next http.Handler) http.Handler {
@@ -30,7 +36,7 @@ func BodyFilter(next http.Handler, conf []config.BodyFilterConfig) kaspHttp.Midd
 		if r == nil {
 			slog.Warn("empty request")
 
-			http.Error(w, "Empty request", http.StatusBadRequest)
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
 
 			return
 		}
@@ -46,34 +52,46 @@ func BodyFilter(next http.Handler, conf []config.BodyFilterConfig) kaspHttp.Midd
 
 		slog.Debug("body filter matched request", "config paths", c.Paths, "path", r.URL.Path)
 
+		m := metrics.RecorderFrom(r.Context())
+		m.ObserveBodyFilter(metrics.BodyFilterMatched)
+
 		if r.Body == nil {
 			slog.Warn("empty request body")
 
-			http.Error(w, "Empty request body", http.StatusBadRequest)
+			m.ObserveBodyFilter(metrics.BodyFilterRejected)
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request body").Status())
 
 			return
 		}
 
 		body, err := decodeBody(r.Body)
 		if err != nil {
-			slog.Error("cannot decode body", "error", err, "body", r.Body)
+			slog.Error("cannot decode body", "error", err, "path", r.URL.Path)
 
-			http.Error(w, "Decoding Error", http.StatusBadRequest)
+			m.ObserveBodyFilter(metrics.BodyFilterRejected)
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("cannot decode request body").Status())
 
 			return
 		}
 
+		// The errors name the keys of the body and of the filter, so they are logged but not sent to the client.
 		filteredBody, err := getFilteredBody(body, c.Filter)
 		if err != nil {
-			slog.Error("cannot get filtered body", "error", err, "body", body, "filter", c.Filter)
+			slog.Error("cannot get filtered body", "error", err, "path", r.URL.Path, "filter", c.Filter)
 
-			statusCode := http.StatusInternalServerError
+			status := apierrors.NewInternalError(ErrBodyFilterFailed).Status()
+			result := metrics.BodyFilterFailed
 
 			if errors.Is(err, ErrDuringBodyFilter) {
-				statusCode = http.StatusBadRequest
+				status = apierrors.NewBadRequest("request body rejected by filter").Status()
+				result = metrics.BodyFilterRejected
 			}
 
-			http.Error(w, "Filter Error", statusCode)
+			m.ObserveBodyFilter(result)
+
+			kube.WriteStatus(w, status)
 
 			return
 		}
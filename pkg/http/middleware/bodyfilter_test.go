@@ -240,6 +240,42 @@ func TestBodyFilter(t *testing.T) {
 	}
 }
 
+func TestBodyFilter_RejectionHidesBody(t *testing.T) {
+	t.Parallel()
+
+	conf := []config.BodyFilterConfig{
+		{
+			Methods: []string{"PATCH"},
+			Paths:   []config.BodyFilterConfigPaths{{Path: "/api/v1/namespaces/default/secrets", Type: "glob"}},
+			Filter:  `{"data":{"password":"*"}}`,
+		},
+	}
+
+	handler := middleware.BodyFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request should have been rejected")
+	}), conf)
+
+	req := httptest.NewRequest("PATCH", "https://api.kube-apiserver-proxy.dev/api/v1/namespaces/default/secrets", nil)
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"data":{"s3cr3t-key":"hunter2"}}`))
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(body), `"message":"request body rejected by filter"`)
+	assert.NotContains(t, string(body), "password")
+	assert.NotContains(t, string(body), "s3cr3t-key")
+}
+
 func TestMatchConfig(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func ClientCertificateMux() kaspHttp.MuxMiddleware {
+	return func(next http.Handler) http.Handler {
+		return ClientCertificate(next)
+	}
+}
+
+// ClientCertificate stores in the request context the identity of the caller presenting a client certificate
+// verified during the tls handshake, mapping its common name to the username and its organizations to the groups.
+// Requests without a verified certificate are passed through as they are: when it runs before the
+// Authentication middleware, a bearer token takes precedence over the certificate.
+func ClientCertificate(next http.Handler) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			slog.Warn("empty request")
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
+
+			return
+		}
+
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		id, err := auth.IdentityFromCertificate(r.TLS.VerifiedChains[0][0])
+		if err != nil {
+			slog.Info("cannot authenticate request", "error", err, "path", r.URL.Path)
+
+			kube.WriteStatus(w, apierrors.NewUnauthorized(err.Error()).Status())
+
+			return
+		}
+
+		slog.Debug("request authenticated", "username", id.Username, "groups", id.Groups, "method", id.Method)
+
+		setAccessLogIdentity(r.Context(), id)
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
@@ -0,0 +1,92 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+)
+
+func TestClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc           string
+		state          *tls.ConnectionState
+		wantStatusCode int
+		wantUsername   string
+		wantGroups     []string
+	}{
+		{
+			desc:           "plain http",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc:           "no client certificate",
+			state:          &tls.ConnectionState{},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			desc: "verified client certificate",
+			state: &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{
+					{Subject: pkix.Name{CommonName: "jane", Organization: []string{"devs"}}},
+				}},
+			},
+			wantStatusCode: http.StatusOK,
+			wantUsername:   "jane",
+			wantGroups:     []string{"devs", auth.AuthenticatedGroup},
+		},
+		{
+			desc: "client certificate without common name",
+			state: &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{
+					{Subject: pkix.Name{Organization: []string{"devs"}}},
+				}},
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got *auth.Identity
+
+			handler := middleware.ClientCertificateMux()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = auth.IdentityFrom(r.Context())
+
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+			req.TLS = tC.state
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tC.wantStatusCode, w.Code)
+
+			if tC.wantUsername == "" {
+				assert.Nil(t, got)
+
+				return
+			}
+
+			if assert.NotNil(t, got) {
+				assert.Equal(t, tC.wantUsername, got.Username)
+				assert.Equal(t, tC.wantGroups, got.Groups)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func ClusterRoutingMux(header string) kaspHttp.MuxMiddleware {
+	return func(next http.Handler) http.Handler {
+		return ClusterRouting(next, header)
+	}
+}
+
+// ClusterRouting stores in the request context the cluster selected by the request, stripping the
+// /clusters/{name} prefix from its path so that the downstream handlers see a plain apiserver path.
+// Requests without the prefix can select the cluster via the given header, when not empty.
+func ClusterRouting(next http.Handler, header string) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if name, path, ok := cutClusterPrefix(r.URL.Path); ok {
+			u := *r.URL
+			u.Path = path
+			u.RawPath = ""
+
+			r = r.WithContext(kube.WithCluster(r.Context(), name))
+			r.URL = &u
+
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if name := r.Header.Get(header); header != "" && name != "" {
+			r = r.WithContext(kube.WithCluster(r.Context(), name))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func cutClusterPrefix(path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, kube.ClusterPathPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	name, path, _ := strings.Cut(rest, "/")
+	if name == "" {
+		return "", "", false
+	}
+
+	return name, "/" + path, true
+}
@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestClusterRouting(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc        string
+		url         string
+		header      string
+		wantCluster string
+		wantPath    string
+	}{
+		{
+			desc:        "path prefix",
+			url:         "/clusters/prod/api/v1/pods",
+			wantCluster: "prod",
+			wantPath:    "/api/v1/pods",
+		},
+		{
+			desc:        "path prefix without trailing path",
+			url:         "/clusters/prod",
+			wantCluster: "prod",
+			wantPath:    "/",
+		},
+		{
+			desc:        "header",
+			url:         "/api/v1/pods",
+			header:      "dev",
+			wantCluster: "dev",
+			wantPath:    "/api/v1/pods",
+		},
+		{
+			desc:        "path prefix wins over header",
+			url:         "/clusters/prod/version",
+			header:      "dev",
+			wantCluster: "prod",
+			wantPath:    "/version",
+		},
+		{
+			desc:     "no cluster",
+			url:      "/api/v1/pods",
+			wantPath: "/api/v1/pods",
+		},
+		{
+			desc:     "cluster listing",
+			url:      "/clusters",
+			wantPath: "/clusters",
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				gotCluster string
+				gotPath    string
+			)
+
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				gotCluster, _ = kube.ClusterFrom(r.Context())
+				gotPath = r.URL.Path
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tC.url, nil)
+			if tC.header != "" {
+				req.Header.Set("X-Kasp-Cluster", tC.header)
+			}
+
+			middleware.ClusterRoutingMux("X-Kasp-Cluster")(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotCluster != tC.wantCluster {
+				t.Errorf("expected cluster %q, got %q", tC.wantCluster, gotCluster)
+			}
+
+			if gotPath != tC.wantPath {
+				t.Errorf("expected path %q, got %q", tC.wantPath, gotPath)
+			}
+		})
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"strings"
 
 	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
 )
 
 type CORSConfig struct {
@@ -24,12 +26,14 @@ func CORSMux(conf CORSConfig) kaspHttp.MuxMiddleware {
 	}
 }
 
+// CORS sets the CORS headers on every response, and answers the preflight requests itself: as they carry
+// no credentials, they must not reach the authentication and authorization middlewares.
 func CORS(next http.Handler, conf CORSConfig) kaspHttp.Middleware {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r == nil {
 			slog.Warn("empty request")
 
-			http.Error(w, "Empty request", http.StatusBadRequest)
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
 
 			return
 		}
@@ -39,10 +43,22 @@ func CORS(next http.Handler, conf CORSConfig) kaspHttp.Middleware {
 		w.Header().Set("Access-Control-Allow-Headers", corsHeaders(conf))
 		w.Header().Set("Access-Control-Allow-Credentials", corsCredentials(conf))
 
+		if isPreflight(r) {
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
 func corsMethod(conf CORSConfig) string {
 	methods := []string{"*"}
 	if conf.AllowMethods != nil {
@@ -111,3 +111,30 @@ func TestCORS(t *testing.T) {
 		})
 	}
 }
+
+func TestCORS_Preflight(t *testing.T) {
+	t.Parallel()
+
+	called := false
+
+	handler := middleware.CORS(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			called = true
+
+			w.WriteHeader(http.StatusUnauthorized)
+		}),
+		middleware.CORSConfig{AllowOrigins: []string{"https://api.kube-apiserver-proxy.dev"}},
+	)
+
+	req := httptest.NewRequest(http.MethodOptions, "https://api.kube-apiserver-proxy.dev/api/v1/pods", nil)
+	req.Header.Set("Origin", "https://api.kube-apiserver-proxy.dev")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.False(t, called, "expected the preflight request not to reach the next handler")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://api.kube-apiserver-proxy.dev", w.Header().Get("Access-Control-Allow-Origin"))
+}
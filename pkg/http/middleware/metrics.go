@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+)
+
+func MetricsMux(m *metrics.Metrics) kaspHttp.MuxMiddleware {
+	return func(next http.Handler) http.Handler {
+		return Metrics(next, m)
+	}
+}
+
+// Metrics counts the requests and measures the time taken to serve them, labelling them with the request info
+// of the apiserver. The group and resource are only used when the apiserver answered the request successfully,
+// so that the clients cannot make up new series. It also stores the metrics in the request context,
+// for the downstream middlewares and the proxy to record their own.
+func Metrics(next http.Handler, m *metrics.Metrics) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		start := time.Now()
+		rec := kaspHttp.NewStatusRecorder(w)
+		ri := kube.RequestInfoFor(r)
+
+		ctx, answered := metrics.WithAnswerTracking(metrics.WithRecorder(r.Context(), m))
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		group, resource := "", ""
+		if answered() {
+			group, resource = ri.APIGroup, ri.Resource
+		}
+
+		m.ObserveRequest(ri.Verb, group, resource, rec.Code(), time.Since(start))
+	})
+}
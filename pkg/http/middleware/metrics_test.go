@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	var got *metrics.Metrics
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = metrics.RecorderFrom(r.Context())
+
+		switch {
+		case r.Header.Get("Authorization") == "":
+			w.WriteHeader(http.StatusUnauthorized)
+
+		case r.Method == http.MethodOptions:
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasPrefix(r.URL.Path, "/apis/made-up.io/"):
+			metrics.MarkAnswered(r.Context(), http.StatusNotFound)
+			w.WriteHeader(http.StatusNotFound)
+
+		default:
+			metrics.MarkAnswered(r.Context(), http.StatusOK)
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	serve := func(method, target string, authenticated bool) {
+		req := httptest.NewRequest(method, target, nil)
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+
+		middleware.MetricsMux(m)(next).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, method := range []string{http.MethodGet, "SCAN", "PROPFIND"} {
+		serve(method, "/apis/made-up.io/v1/namespaces/default/things-"+method, false)
+		serve(method, "/apis/made-up.io/v1/namespaces/default/things-"+method, true)
+	}
+
+	serve(http.MethodOptions, "/apis/made-up.io/v1/namespaces/default/things", true)
+	serve(http.MethodGet, "/apis/apps/v1/namespaces/default/deployments/web", true)
+
+	if got != m {
+		t.Error("expected the metrics to be stored in the request context")
+	}
+
+	want := `
+# HELP kube_apiserver_proxy_http_requests_total Number of requests served by the proxy, by verb, group, resource and status code.
+# TYPE kube_apiserver_proxy_http_requests_total counter
+kube_apiserver_proxy_http_requests_total{code="200",group="apps",resource="deployments",verb="get"} 1
+kube_apiserver_proxy_http_requests_total{code="204",group="",resource="",verb="other"} 1
+kube_apiserver_proxy_http_requests_total{code="401",group="",resource="",verb="list"} 1
+kube_apiserver_proxy_http_requests_total{code="401",group="",resource="",verb="other"} 2
+kube_apiserver_proxy_http_requests_total{code="404",group="",resource="",verb="list"} 1
+kube_apiserver_proxy_http_requests_total{code="404",group="",resource="",verb="other"} 2
+`
+
+	if err := testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(want),
+		"kube_apiserver_proxy_http_requests_total",
+	); err != nil {
+		t.Error(err)
+	}
+}
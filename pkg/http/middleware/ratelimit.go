@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+	"github.com/omissis/kube-apiserver-proxy/pkg/ratelimit"
+)
+
+func RateLimitMux(rules []config.RateLimitRule) kaspHttp.MuxMiddleware {
+	limiter := ratelimit.NewLimiter(rules)
+
+	return func(next http.Handler) http.Handler {
+		return RateLimit(next, limiter)
+	}
+}
+
+// RateLimit takes a token from the bucket of the caller for the first rule matching the request, and rejects
+// the request with a 429 status when the bucket is empty, telling the caller how long to wait before retrying.
+// The identity stored in the request context by the Authentication middleware is used as the key of the
+// per-user rules, treating requests without one as anonymous.
+func RateLimit(next http.Handler, limiter *ratelimit.Limiter) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			slog.Warn("empty request")
+
+			kube.WriteStatus(w, apierrors.NewBadRequest("empty request").Status())
+
+			return
+		}
+
+		id, ok := auth.IdentityFrom(r.Context())
+		if !ok {
+			id = auth.Anonymous()
+		}
+
+		decision := limiter.Allow(r, id, kube.RequestInfoFor(r))
+		if decision.Rule == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		m := metrics.RecorderFrom(r.Context())
+		m.ObserveRateLimit(decision.Rule, !decision.Allowed)
+		m.SetRateLimiterKeys(decision.Rule, decision.Keys)
+
+		if !decision.Allowed {
+			slog.Info("request rate limited", "username", id.Username, "rule", decision.Rule, "path", r.URL.Path)
+
+			retryAfter := decision.RetryAfterSeconds()
+
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+			kube.WriteStatus(w, apierrors.NewTooManyRequests(
+				fmt.Sprintf("rate limit %q exceeded, please retry later", decision.Rule),
+				retryAfter,
+			).Status())
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
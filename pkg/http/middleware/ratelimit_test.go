@@ -0,0 +1,86 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	rules := []config.RateLimitRule{
+		{
+			Name:  "per-user",
+			Key:   "user",
+			Verbs: []string{"list"},
+			QPS:   0.001,
+			Burst: 1,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.RateLimitMux(rules)(next)
+
+	serve := func(target, username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if username != "" {
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Username: username}))
+		}
+
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	if rec := serve("/api/v1/pods", "jane"); rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	if rec := serve("/api/v1/pods", "john"); rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d for another user, got %d", http.StatusOK, rec.Code)
+	}
+
+	if rec := serve("/api/v1/namespaces/default/pods/web-0", "jane"); rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d for an unlimited verb, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec := serve("/api/v1/pods", "jane")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+
+	if got := rec.Header().Get("Retry-After"); got == "" || got == "0" {
+		t.Errorf("expected a Retry-After header, got %q", got)
+	}
+
+	var status metav1.Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("cannot decode status: %v", err)
+	}
+
+	if status.Reason != metav1.StatusReasonTooManyRequests {
+		t.Errorf("expected reason %q, got %q", metav1.StatusReasonTooManyRequests, status.Reason)
+	}
+
+	if status.Details == nil || status.Details.RetryAfterSeconds < 1 {
+		t.Errorf("expected the retry after seconds in the status details, got %+v", status.Details)
+	}
+
+	if !strings.Contains(status.Message, "per-user") {
+		t.Errorf("expected message to name rule %q, got %q", "per-user", status.Message)
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func RequestInfoMux() kaspHttp.MuxMiddleware {
+	return func(next http.Handler) http.Handler {
+		return RequestInfo(next)
+	}
+}
+
+// RequestInfo parses the request the same way the apiserver does and stores the result in the request context,
+// so that the downstream middlewares and the proxy can share it instead of parsing the request on their own.
+func RequestInfo(next http.Handler) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(kube.WithRequestInfo(r.Context(), kube.ParseRequestInfo(r))))
+	})
+}
@@ -0,0 +1,32 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestRequestInfo(t *testing.T) {
+	t.Parallel()
+
+	var got *kube.RequestInfo
+
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got, _ = kube.RequestInfoFrom(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/default/pods?watch=1", nil)
+
+	middleware.RequestInfoMux()(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil {
+		t.Fatal("expected request info in the request context, got none")
+	}
+
+	if got.Verb != kube.VerbWatch || got.Namespace != "default" || got.Resource != "pods" {
+		t.Errorf("unexpected request info: %+v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/tracing"
+)
+
+func TracingMux(tp trace.TracerProvider) kaspHttp.MuxMiddleware {
+	tracer := tracing.Tracer(tp)
+
+	return func(next http.Handler) http.Handler {
+		return Tracing(next, tracer)
+	}
+}
+
+// Tracing starts the server span of each request, continuing the W3C trace context sent by the caller, if any.
+// The span is named after the method only, as the paths are chosen freely by the clients: they are recorded
+// in the http.target attribute instead.
+func Tracing(next http.Handler, tracer trace.Tracer) kaspHttp.Middleware {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(
+			ctx,
+			"HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPTarget(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := kaspHttp.NewStatusRecorder(w)
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(rec.Code()))
+
+		if rec.Code() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Code()))
+		}
+	})
+}
+
+// Traced wraps the given middleware in a span named after it, to tell apart the time spent in each middleware.
+func Traced(tp trace.TracerProvider, name string, mw kaspHttp.MuxMiddleware) kaspHttp.MuxMiddleware {
+	tracer := tracing.Tracer(tp)
+
+	return func(next http.Handler) http.Handler {
+		h := mw(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r == nil {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			ctx, span := tracer.Start(r.Context(), "middleware."+name)
+			defer span.End()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/http/middleware"
+)
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	noop := func(next http.Handler) http.Handler {
+		return next
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	handler := middleware.TracingMux(tp)(middleware.Traced(tp, "noop", noop)(next))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	mw, server := spans[0], spans[1]
+
+	if server.Name != "HTTP GET" || server.SpanKind != trace.SpanKindServer {
+		t.Errorf("unexpected server span: %s %s", server.Name, server.SpanKind)
+	}
+
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace of the caller to be continued, got trace id %s", got)
+	}
+
+	if got := server.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("expected the span of the caller as parent, got %s", got)
+	}
+
+	if server.Status.Code.String() != "Error" {
+		t.Errorf("expected the server span to be marked as failed, got %s", server.Status.Code)
+	}
+
+	if mw.Name != "middleware.noop" || mw.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("expected the middleware span to be a child of the server one, got %s", mw.Name)
+	}
+}
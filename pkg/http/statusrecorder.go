@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+)
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, code: http.StatusOK}
+}
+
+// StatusRecorder captures the status code and the size of the response written by the downstream handlers.
+// It implements Unwrap, so that http.ResponseController can still reach the methods of the wrapped writer,
+// such as the Flush one that watches need.
+type StatusRecorder struct {
+	http.ResponseWriter
+	code        int
+	size        int
+	wroteHeader bool
+}
+
+func (w *StatusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *StatusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+
+	return n, err
+}
+
+func (w *StatusRecorder) Flush() {
+	w.wroteHeader = true
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *StatusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Code returns the status code of the response, which defaults to 200 when the handlers did not set one.
+func (w *StatusRecorder) Code() int {
+	return w.code
+}
+
+// Size returns the number of bytes of the response body written so far.
+func (w *StatusRecorder) Size() int {
+	return w.size
+}
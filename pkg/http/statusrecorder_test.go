@@ -0,0 +1,45 @@
+//go:build unit
+
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	w := httpx.NewStatusRecorder(rec)
+
+	if got := w.Code(); got != http.StatusOK {
+		t.Errorf("expected default status code %d, got %d", http.StatusOK, got)
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if _, err := w.Write([]byte("not found")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Errorf("expected the recorder to be flushable, got %v", err)
+	}
+
+	if got := w.Code(); got != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, got)
+	}
+
+	if got := w.Size(); got != len("not found") {
+		t.Errorf("expected size %d, got %d", len("not found"), got)
+	}
+
+	if !rec.Flushed {
+		t.Error("expected the wrapped writer to be flushed")
+	}
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+func NewSwappableHandler(h http.Handler) *SwappableHandler {
+	s := &SwappableHandler{}
+	s.Swap(h)
+
+	return s
+}
+
+// SwappableHandler serves each request with the handler it holds at the time the request comes in,
+// so that the handler can be replaced while serving without affecting the requests already in flight.
+type SwappableHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (s *SwappableHandler) Swap(h http.Handler) {
+	s.handler.Store(&h)
+}
+
+func (s *SwappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
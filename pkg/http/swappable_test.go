@@ -0,0 +1,61 @@
+//go:build unit
+
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
+)
+
+func TestSwappableHandler(t *testing.T) {
+	t.Parallel()
+
+	status := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+
+	h := httpx.NewSwappableHandler(status(http.StatusOK))
+
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		return rec.Code
+	}
+
+	if got := serve(); got != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, got)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			h.Swap(status(http.StatusTeapot))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			if got := serve(); got != http.StatusOK && got != http.StatusTeapot {
+				t.Errorf("unexpected status code %d", got)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := serve(); got != http.StatusTeapot {
+		t.Errorf("expected status code %d, got %d", http.StatusTeapot, got)
+	}
+}
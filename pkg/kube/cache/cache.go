@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+)
+
+var ErrCannotCreateClient = errors.New("cannot create the client of the cache")
+
+// New creates the informers of the given resources, which start syncing when Start is called.
+func New(restConfig *rest.Config, resources []config.CachedResource) (*Cache, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotCreateClient, err)
+	}
+
+	return NewForClient(client, resources), nil
+}
+
+// NewForClient is like New, but it uses the given client.
+func NewForClient(client dynamic.Interface, resources []config.CachedResource) *Cache {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+
+	c := &Cache{
+		factory:   factory,
+		resources: make(map[schema.GroupVersionResource]*resource, len(resources)),
+	}
+
+	for _, r := range resources {
+		gvr := schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+
+		c.resources[gvr] = &resource{
+			informer:   factory.ForResource(gvr).Informer(),
+			staleReads: r.StaleReads,
+		}
+	}
+
+	return c
+}
+
+// Cache answers the get and list requests of a set of resources from the stores of their informers,
+// following the resourceVersion semantics of the apiserver: requests asking for data more recent than
+// the store, or for features the store cannot provide, such as field selectors and pagination, are left
+// to the apiserver.
+type Cache struct {
+	factory   dynamicinformer.DynamicSharedInformerFactory
+	resources map[schema.GroupVersionResource]*resource
+}
+
+type resource struct {
+	informer   toolscache.SharedIndexInformer
+	staleReads bool
+}
+
+// Start runs the informers until the context is done. It does not wait for them to sync:
+// until they do, the requests are left to the apiserver.
+func (c *Cache) Start(ctx context.Context) {
+	c.factory.Start(ctx.Done())
+}
+
+// HasSynced tells whether all the informers have completed their initial list.
+func (c *Cache) HasSynced() bool {
+	for _, r := range c.resources {
+		if !r.informer.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Lookup returns the json body answering the request from the cache, or false when the request is to be
+// sent to the apiserver.
+func (c *Cache) Lookup(r *http.Request) ([]byte, bool) {
+	ri := kube.RequestInfoFor(r)
+
+	if !ri.IsResourceRequest || ri.Subresource != "" || (ri.Verb != kube.VerbGet && ri.Verb != kube.VerbList) {
+		return nil, false
+	}
+
+	res, ok := c.resources[schema.GroupVersionResource{Group: ri.APIGroup, Version: ri.APIVersion, Resource: ri.Resource}]
+	if !ok {
+		return nil, false
+	}
+
+	body, ok := res.lookup(r, ri)
+
+	metrics.RecorderFrom(r.Context()).ObserveCacheLookup(ri.APIGroup, ri.Resource, ok)
+
+	return body, ok
+}
+
+func (res *resource) lookup(r *http.Request, ri *kube.RequestInfo) ([]byte, bool) {
+	if !res.informer.HasSynced() || !acceptsJSON(r.Header.Get("Accept")) {
+		return nil, false
+	}
+
+	rv := res.informer.LastSyncResourceVersion()
+	query := r.URL.Query()
+
+	if !res.canServe(query, ri.Verb, rv) {
+		return nil, false
+	}
+
+	if ri.Verb == kube.VerbGet {
+		return res.get(ri)
+	}
+
+	return res.list(query, ri, rv)
+}
+
+// canServe tells whether the store, synced at the given resourceVersion, satisfies the resourceVersion
+// constraints of the request, and whether it has all it takes to answer it.
+func (res *resource) canServe(query url.Values, verb, storeRV string) bool {
+	if query.Get("fieldSelector") != "" || query.Get("continue") != "" {
+		return false
+	}
+
+	if query.Get("resourceVersionMatch") == "Exact" {
+		return false
+	}
+
+	limited := verb == kube.VerbList && query.Get("limit") != ""
+
+	switch rv := query.Get("resourceVersion"); rv {
+	case "":
+		// The most recent data is asked for, paginated when a limit is set.
+		return res.staleReads && !limited
+
+	case "0":
+		// Any data is fine, and the apiserver itself ignores the limit when serving it from its watch cache.
+		return true
+
+	default:
+		// Without resourceVersionMatch, paginated lists at a given resourceVersion ask for that exact one.
+		if limited && query.Get("resourceVersionMatch") == "" {
+			return false
+		}
+
+		return notOlderThan(storeRV, rv)
+	}
+}
+
+func (res *resource) get(ri *kube.RequestInfo) ([]byte, bool) {
+	key := ri.Name
+	if ri.Namespace != "" {
+		key = ri.Namespace + "/" + ri.Name
+	}
+
+	item, exists, err := res.informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		// The apiserver tells apart the objects that do not exist from the ones the cache has not seen yet.
+		return nil, false
+	}
+
+	obj, ok := item.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+
+	body, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, false
+	}
+
+	return body, true
+}
+
+type list struct {
+	Kind       string           `json:"kind"`
+	APIVersion string           `json:"apiVersion"`
+	Metadata   listMeta         `json:"metadata"`
+	Items      []map[string]any `json:"items"`
+}
+
+type listMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+func (res *resource) list(query url.Values, ri *kube.RequestInfo, rv string) ([]byte, bool) {
+	selector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		// The apiserver answers with the proper validation error.
+		return nil, false
+	}
+
+	var items []any
+
+	if ri.Namespace != "" {
+		items, err = res.informer.GetIndexer().ByIndex(toolscache.NamespaceIndex, ri.Namespace)
+		if err != nil {
+			return nil, false
+		}
+	} else {
+		items = res.informer.GetIndexer().List()
+	}
+
+	objs := make([]*unstructured.Unstructured, 0, len(items))
+
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if ok && selector.Matches(labels.Set(obj.GetLabels())) {
+			objs = append(objs, obj)
+		}
+	}
+
+	// The kind of the list is taken from its items: an empty list is left to the apiserver, which knows it.
+	if len(objs) == 0 {
+		return nil, false
+	}
+
+	// The apiserver lists the objects sorted by namespace and name.
+	sort.Slice(objs, func(i, j int) bool {
+		if objs[i].GetNamespace() != objs[j].GetNamespace() {
+			return objs[i].GetNamespace() < objs[j].GetNamespace()
+		}
+
+		return objs[i].GetName() < objs[j].GetName()
+	})
+
+	l := list{
+		Kind:       objs[0].GetKind() + "List",
+		APIVersion: objs[0].GetAPIVersion(),
+		Metadata:   listMeta{ResourceVersion: rv},
+		Items:      make([]map[string]any, 0, len(objs)),
+	}
+
+	for _, obj := range objs {
+		l.Items = append(l.Items, obj.Object)
+	}
+
+	body, err := json.Marshal(l)
+	if err != nil {
+		return nil, false
+	}
+
+	return body, true
+}
+
+// notOlderThan tells whether the store resourceVersion is at least the requested one. ResourceVersions are
+// meant to be opaque, but the apiserver compares them as integers: when they are not, the store cannot tell.
+func notOlderThan(storeRV, requestedRV string) bool {
+	store, err := strconv.ParseUint(storeRV, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	requested, err := strconv.ParseUint(requestedRV, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return store >= requested
+}
+
+// acceptsJSON tells whether the client accepts plain json objects: the ones asking for protobuf only,
+// or for a different representation such as tables, are left to the apiserver.
+func acceptsJSON(accept string) bool {
+	if accept == "" {
+		return true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		if _, ok := params["as"]; ok {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+
+	return false
+}
+
+// Clusters holds a cache per cluster, looking requests up in the one of the cluster they select.
+type Clusters struct {
+	caches         map[string]*Cache
+	defaultCluster string
+}
+
+func NewClusters(caches map[string]*Cache, defaultCluster string) *Clusters {
+	return &Clusters{caches: caches, defaultCluster: defaultCluster}
+}
+
+func (c *Clusters) Lookup(r *http.Request) ([]byte, bool) {
+	name, ok := kube.ClusterFrom(r.Context())
+	if !ok {
+		name = c.defaultCluster
+	}
+
+	cache, ok := c.caches[name]
+	if !ok {
+		return nil, false
+	}
+
+	return cache.Lookup(r)
+}
+
+func (c *Clusters) Start(ctx context.Context) {
+	for _, cache := range c.caches {
+		cache.Start(ctx)
+	}
+}
@@ -0,0 +1,271 @@
+//go:build unit
+
+package cache_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/cache"
+)
+
+func TestCache_Lookup(t *testing.T) {
+	t.Parallel()
+
+	c := newSyncedCache(t)
+
+	testCases := []struct {
+		desc      string
+		url       string
+		accept    string
+		wantNames []string
+		wantKind  string
+	}{
+		{
+			desc:      "list at any resource version",
+			url:       "/api/v1/pods?resourceVersion=0",
+			wantKind:  "PodList",
+			wantNames: []string{"api", "web", "db"},
+		},
+		{
+			desc:      "list in a namespace with a label selector",
+			url:       "/api/v1/namespaces/default/pods?resourceVersion=0&labelSelector=app%3Dweb",
+			wantKind:  "PodList",
+			wantNames: []string{"web"},
+		},
+		{
+			desc:      "list not older than a resource version",
+			url:       "/api/v1/pods?resourceVersion=5",
+			wantKind:  "PodList",
+			wantNames: []string{"api", "web", "db"},
+		},
+		{
+			desc: "list newer than the cache",
+			url:  "/api/v1/pods?resourceVersion=20",
+		},
+		{
+			desc: "list at an exact resource version",
+			url:  "/api/v1/pods?resourceVersion=5&resourceVersionMatch=Exact",
+		},
+		{
+			desc: "paginated list at a resource version",
+			url:  "/api/v1/pods?resourceVersion=5&limit=1",
+		},
+		{
+			desc: "list of the most recent data",
+			url:  "/api/v1/pods",
+		},
+		{
+			desc:      "list of the most recent data of a resource allowing stale reads",
+			url:       "/api/v1/configmaps",
+			wantKind:  "ConfigMapList",
+			wantNames: []string{"settings"},
+		},
+		{
+			desc: "paginated list of the most recent data of a resource allowing stale reads",
+			url:  "/api/v1/configmaps?limit=10",
+		},
+		{
+			desc: "list with a field selector",
+			url:  "/api/v1/pods?resourceVersion=0&fieldSelector=spec.nodeName%3Dnode-1",
+		},
+		{
+			desc: "list with no matching object",
+			url:  "/api/v1/namespaces/kube-system/pods?resourceVersion=0",
+		},
+		{
+			desc:      "get",
+			url:       "/api/v1/namespaces/default/pods/web?resourceVersion=0",
+			wantKind:  "Pod",
+			wantNames: []string{"web"},
+		},
+		{
+			desc: "get of a missing object",
+			url:  "/api/v1/namespaces/default/pods/missing?resourceVersion=0",
+		},
+		{
+			desc: "get of a subresource",
+			url:  "/api/v1/namespaces/default/pods/web/status?resourceVersion=0",
+		},
+		{
+			desc: "watch",
+			url:  "/api/v1/pods?watch=true&resourceVersion=0",
+		},
+		{
+			desc: "resource not cached",
+			url:  "/api/v1/secrets?resourceVersion=0",
+		},
+		{
+			desc:   "table",
+			url:    "/api/v1/pods?resourceVersion=0",
+			accept: "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io",
+		},
+		{
+			desc:   "protobuf",
+			url:    "/api/v1/pods?resourceVersion=0",
+			accept: "application/vnd.kubernetes.protobuf",
+		},
+		{
+			desc:      "protobuf or json",
+			url:       "/api/v1/pods?resourceVersion=0",
+			accept:    "application/vnd.kubernetes.protobuf, application/json",
+			wantKind:  "PodList",
+			wantNames: []string{"api", "web", "db"},
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tC.url, nil)
+			if tC.accept != "" {
+				r.Header.Set("Accept", tC.accept)
+			}
+
+			body, ok := c.Lookup(r)
+			if ok != (tC.wantKind != "") {
+				t.Fatalf("expected the request to be served from the cache: %t, got %t", tC.wantKind != "", ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			var got struct {
+				Kind     string `json:"kind"`
+				Metadata struct {
+					Name            string `json:"name"`
+					ResourceVersion string `json:"resourceVersion"`
+				} `json:"metadata"`
+				Items []struct {
+					Metadata struct {
+						Name string `json:"name"`
+					} `json:"metadata"`
+				} `json:"items"`
+			}
+
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("cannot decode body: %v", err)
+			}
+
+			if got.Kind != tC.wantKind {
+				t.Errorf("expected kind %s, got %s", tC.wantKind, got.Kind)
+			}
+
+			names := []string{got.Metadata.Name}
+
+			if len(got.Items) > 0 || got.Metadata.Name == "" {
+				names = names[:0]
+
+				if got.Metadata.ResourceVersion != "10" {
+					t.Errorf("expected the list to be at resource version 10, got %q", got.Metadata.ResourceVersion)
+				}
+
+				for _, item := range got.Items {
+					names = append(names, item.Metadata.Name)
+				}
+			}
+
+			if diff := cmp.Diff(tC.wantNames, names); diff != "" {
+				t.Errorf("unexpected objects (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCache_LookupNotSynced(t *testing.T) {
+	t.Parallel()
+
+	c := cache.NewForClient(
+		dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		[]config.CachedResource{{Version: "v1", Resource: "pods"}},
+	)
+
+	if _, ok := c.Lookup(httptest.NewRequest(http.MethodGet, "/api/v1/pods?resourceVersion=0", nil)); ok {
+		t.Error("expected the requests to be sent to the apiserver until the cache is synced")
+	}
+}
+
+func newSyncedCache(t *testing.T) *cache.Cache {
+	t.Helper()
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pods: "PodList", configMaps: "ConfigMapList"},
+	)
+
+	lists := map[string]*unstructured.UnstructuredList{
+		"pods": newList("PodList",
+			newObject("Pod", "default", "web", map[string]any{"app": "web"}),
+			newObject("Pod", "default", "api", map[string]any{"app": "api"}),
+			newObject("Pod", "storage", "db", nil),
+		),
+		"configmaps": newList("ConfigMapList", newObject("ConfigMap", "default", "settings", nil)),
+	}
+
+	// The fake client does not set the resource version of the lists, which the cache relies on.
+	client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, lists[action.GetResource().Resource].DeepCopy(), nil
+	})
+
+	c := cache.NewForClient(client, []config.CachedResource{
+		{Version: "v1", Resource: "pods"},
+		{Version: "v1", Resource: "configmaps", StaleReads: true},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !c.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the cache to sync")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return c
+}
+
+func newList(kind string, items ...unstructured.Unstructured) *unstructured.UnstructuredList {
+	l := &unstructured.UnstructuredList{Items: items}
+	l.SetAPIVersion("v1")
+	l.SetKind(kind)
+	l.SetResourceVersion("10")
+
+	return l
+}
+
+func newObject(kind, namespace, name string, labels map[string]any) unstructured.Unstructured {
+	metadata := map[string]any{"name": name, "namespace": namespace}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+
+	return unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata":   metadata,
+	}}
+}
@@ -3,10 +3,17 @@ package kube
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/cache"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/rest"
 	"k8s.io/kubectl/pkg/scheme"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
 )
 
 type RESTClientFactory interface {
@@ -14,59 +21,172 @@ type RESTClientFactory interface {
 	Request(r http.Request) (*rest.Request, error)
 }
 
+// Invalidator is implemented by the factories caching clients, to drop them when their config changes.
+type Invalidator interface {
+	Invalidate()
+}
+
+// CacheSizer is implemented by the factories caching clients, to report how many they hold.
+type CacheSizer interface {
+	CacheSize() int
+}
+
+type RESTClientFactoryOption func(*DefaultRESTClientFactory)
+
+// WithRequestHeaderPolicy sets the policy deciding which headers of the incoming request are forwarded.
+func WithRequestHeaderPolicy(policy httpx.HeaderPolicy) RESTClientFactoryOption {
+	return func(k *DefaultRESTClientFactory) {
+		k.requestHeaders = policy
+	}
+}
+
+// WithImpersonation makes the factory impersonate the identity stored in the context of the incoming request.
+func WithImpersonation(conf config.Impersonation) RESTClientFactoryOption {
+	return func(k *DefaultRESTClientFactory) {
+		k.impersonation = conf
+	}
+}
+
 func NewDefaultRESTClientFactory(
 	restConfigFactory RESTConfigFactory,
 	httpClient *http.Client,
 	kubeconfigPath string,
+	opts ...RESTClientFactoryOption,
 ) *DefaultRESTClientFactory {
-	return &DefaultRESTClientFactory{
+	if httpClient != nil {
+		hc := *httpClient
+		hc.Transport = ObserveResponses(httpClient.Transport)
+		httpClient = &hc
+	}
+
+	k := &DefaultRESTClientFactory{
 		restConfigFactory: restConfigFactory,
 		httpClient:        httpClient,
 		kubeconfigPath:    kubeconfigPath,
+		requestHeaders:    httpx.NewRequestHeaderPolicy(config.HeaderPolicy{}),
 	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k
 }
 
 type DefaultRESTClientFactory struct {
-	clients           map[string]map[string]*rest.RESTClient
+	mu                sync.Mutex
+	clients           map[string]*clientEntry
+	sharedHTTPClient  *http.Client
 	restConfigFactory RESTConfigFactory
 	httpClient        *http.Client
 	kubeconfigPath    string
+	requestHeaders    httpx.HeaderPolicy
+	impersonation     config.Impersonation
+	passthrough       config.Passthrough
+	tokenClients      *cache.LRUExpireCache
+	tokenClientsMu    sync.Mutex
 }
 
+// clientEntry is a client that is either being created or already created: concurrent callers asking
+// for the same group and version wait for the first one to create it, rather than creating their own.
+type clientEntry struct {
+	done   chan struct{}
+	client *rest.RESTClient
+	err    error
+}
+
+// Client returns the client of the given group and version, creating it on first use.
+// It is safe for concurrent use.
 func (k *DefaultRESTClientFactory) Client(group, version string) (*rest.RESTClient, error) {
+	key := group + "/" + version
+
+	k.mu.Lock()
+
 	if k.clients == nil {
-		k.clients = make(map[string]map[string]*rest.RESTClient)
+		k.clients = make(map[string]*clientEntry)
 	}
 
-	_, ok := k.clients[group][version]
-	if !ok {
-		cfg, err := k.newRESTConfig(group, version)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create rest config: %w", err)
-		}
+	if e, ok := k.clients[key]; ok {
+		k.mu.Unlock()
 
-		clt, err := k.newRESTClient(cfg)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create rest client: %w", err)
-		}
+		<-e.done
+
+		return e.client, e.err
+	}
+
+	e := &clientEntry{done: make(chan struct{})}
+	k.clients[key] = e
 
-		if k.clients[group] == nil {
-			k.clients[group] = make(map[string]*rest.RESTClient)
+	k.mu.Unlock()
+
+	e.client, e.err = k.newClient(group, version)
+	if e.err != nil {
+		// Failures are not cached, so that the next callers try again.
+		k.mu.Lock()
+		if k.clients[key] == e {
+			delete(k.clients, key)
 		}
+		k.mu.Unlock()
+	}
+
+	close(e.done)
+
+	return e.client, e.err
+}
 
-		k.clients[group][version] = clt
+// CacheSize returns the number of cached clients, including the ones created for the passthrough tokens.
+func (k *DefaultRESTClientFactory) CacheSize() int {
+	k.mu.Lock()
+	size := len(k.clients)
+	k.mu.Unlock()
+
+	if k.tokenClients != nil {
+		k.tokenClientsMu.Lock()
+		size += len(k.tokenClients.Keys())
+		k.tokenClientsMu.Unlock()
 	}
 
-	return k.clients[group][version], nil
+	return size
+}
+
+// Invalidate drops all the cached clients, so that the next requests create them anew from a fresh rest config:
+// it is meant to be called when the kubeconfig or the credentials in it change.
+func (k *DefaultRESTClientFactory) Invalidate() {
+	k.mu.Lock()
+	k.clients = nil
+	hc := k.sharedHTTPClient
+	k.sharedHTTPClient = nil
+	k.mu.Unlock()
+
+	if hc != nil {
+		utilnet.CloseIdleConnectionsFor(hc.Transport)
+	}
+
+	if k.tokenClients != nil {
+		k.tokenClientsMu.Lock()
+		for _, key := range k.tokenClients.Keys() {
+			k.tokenClients.Remove(key)
+		}
+		k.tokenClientsMu.Unlock()
+	}
 }
 
 func (k *DefaultRESTClientFactory) Request(r http.Request) (*rest.Request, error) {
-	group, version, err := GetGroupVersionFromURI(r.URL.Path)
+	// Non-resource requests, such as discovery or /version, are served by an unversioned client.
+	var group, version string
+
+	if ri := RequestInfoFor(&r); ri.IsResourceRequest {
+		group, version = ri.APIGroup, ri.APIVersion
+	}
+
+	id, _ := auth.IdentityFrom(r.Context())
+
+	ih, err := ImpersonationHeaders(id, k.impersonation)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get group and version from request uri: %w", err)
+		return nil, fmt.Errorf("cannot get impersonation headers: %w", err)
 	}
 
-	rc, err := k.Client(group, version)
+	rc, err := k.requestClient(r, group, version)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create rest client: %w", err)
 	}
@@ -78,19 +198,70 @@ func (k *DefaultRESTClientFactory) Request(r http.Request) (*rest.Request, error
 
 	req := rest.NewRequest(rc).
 		Verb(r.Method).
-		RequestURI(uri).
-		SetHeader("Content-Type", r.Header.Get("Content-Type")).
-		Body(r.Body)
+		RequestURI(uri)
+
+	if r.Body != nil {
+		req = req.Body(r.Body)
+	}
+
+	for name, values := range k.requestHeaders.Filter(r.Header) {
+		req.SetHeader(name, values...)
+	}
+
+	for name, values := range ih {
+		req.SetHeader(name, values...)
+	}
 
 	return req, nil
 }
 
-func (k *DefaultRESTClientFactory) newRESTClient(config *rest.Config) (*rest.RESTClient, error) {
-	if k.httpClient == nil {
-		return rest.RESTClientFor(config)
+func (k *DefaultRESTClientFactory) requestClient(r http.Request, group, version string) (*rest.RESTClient, error) {
+	if k.passthrough.Enabled {
+		return k.passthroughClient(r, group, version)
+	}
+
+	return k.Client(group, version)
+}
+
+func (k *DefaultRESTClientFactory) newClient(group, version string) (*rest.RESTClient, error) {
+	cfg, err := k.newRESTConfig(group, version)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rest config: %w", err)
+	}
+
+	hc, err := k.httpClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rest client: %w", err)
+	}
+
+	clt, err := restClientFor(cfg, hc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rest client: %w", err)
+	}
+
+	return clt, nil
+}
+
+// httpClientFor returns the http client given to the factory, if any, or the one shared by all the clients
+// of the factory otherwise, so that they reuse the same connections to the apiserver.
+func (k *DefaultRESTClientFactory) httpClientFor(cfg *rest.Config) (*http.Client, error) {
+	if k.httpClient != nil {
+		return k.httpClient, nil
 	}
 
-	return rest.RESTClientForConfigAndClient(config, k.httpClient)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.sharedHTTPClient == nil {
+		hc, err := rest.HTTPClientFor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create http client: %w", err)
+		}
+
+		k.sharedHTTPClient = hc
+	}
+
+	return k.sharedHTTPClient, nil
 }
 
 func (k *DefaultRESTClientFactory) newRESTConfig(group, version string) (*rest.Config, error) {
@@ -99,13 +270,39 @@ func (k *DefaultRESTClientFactory) newRESTConfig(group, version string) (*rest.C
 		return nil, fmt.Errorf("cannot create rest config: %w", err)
 	}
 
-	config.GroupVersion = &schema.GroupVersion{
-		Group:   group,
-		Version: version,
+	config.Wrap(ObserveResponses)
+
+	return withGroupVersion(config, group, version), nil
+}
+
+// withGroupVersion sets the group version of the config, leaving it unset for the unversioned clients
+// used to proxy non-resource requests.
+func withGroupVersion(config *rest.Config, group, version string) *rest.Config {
+	if version != "" {
+		config.GroupVersion = &schema.GroupVersion{
+			Group:   group,
+			Version: version,
+		}
 	}
 
-	// config.APIPath = "/apis"
 	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
 
-	return config, nil
+	return config
+}
+
+func restClientFor(config *rest.Config, httpClient *http.Client) (*rest.RESTClient, error) {
+	if httpClient == nil {
+		hc, err := rest.HTTPClientFor(config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create http client: %w", err)
+		}
+
+		httpClient = hc
+	}
+
+	if config.GroupVersion == nil {
+		return rest.UnversionedRESTClientForConfigAndClient(config, httpClient)
+	}
+
+	return rest.RESTClientForConfigAndClient(config, httpClient)
 }
@@ -0,0 +1,161 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+var errFlakyConfig = errors.New("flaky config")
+
+// countingRESTConfigFactory counts the configs it creates, slowing down their creation
+// to widen the window in which concurrent callers may race.
+type countingRESTConfigFactory struct {
+	calls    atomic.Int32
+	failures atomic.Int32
+}
+
+func (c *countingRESTConfigFactory) New(string) (*rest.Config, error) {
+	c.calls.Add(1)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if c.failures.Add(-1) >= 0 {
+		return nil, errFlakyConfig
+	}
+
+	return &rest.Config{Host: "https://kasp.test"}, nil
+}
+
+func TestDefaultRESTClientFactory_ClientConcurrentCreation(t *testing.T) {
+	t.Parallel()
+
+	cf := &countingRESTConfigFactory{}
+	f := kube.NewDefaultRESTClientFactory(cf, nil, "")
+
+	const callers = 50
+
+	var wg sync.WaitGroup
+
+	clients := make([]*rest.RESTClient, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			clt, err := f.Client("apps", "v1")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			clients[i] = clt
+		}(i)
+	}
+
+	wg.Wait()
+
+	if got := cf.calls.Load(); got != 1 {
+		t.Errorf("expected the client to be created once, got %d creations", got)
+	}
+
+	for i, clt := range clients {
+		if clt != clients[0] {
+			t.Errorf("expected caller %d to get the shared client", i)
+		}
+	}
+}
+
+func TestDefaultRESTClientFactory_ClientFailureIsNotCached(t *testing.T) {
+	t.Parallel()
+
+	cf := &countingRESTConfigFactory{}
+	cf.failures.Store(1)
+
+	f := kube.NewDefaultRESTClientFactory(cf, nil, "")
+
+	if _, err := f.Client("apps", "v1"); !errors.Is(err, errFlakyConfig) {
+		t.Fatalf("expected error %v, got %v", errFlakyConfig, err)
+	}
+
+	if _, err := f.Client("apps", "v1"); err != nil {
+		t.Fatalf("expected the second attempt to succeed, got %v", err)
+	}
+
+	if got := cf.calls.Load(); got != 2 {
+		t.Errorf("expected 2 creations, got %d", got)
+	}
+}
+
+func TestDefaultRESTClientFactory_Invalidate(t *testing.T) {
+	t.Parallel()
+
+	cf := &countingRESTConfigFactory{}
+	f := kube.NewDefaultRESTClientFactory(cf, nil, "")
+
+	before, err := f.Client("", "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f.Invalidate()
+
+	after, err := f.Client("", "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if before == after {
+		t.Error("expected a new client after invalidation")
+	}
+
+	if got := cf.calls.Load(); got != 2 {
+		t.Errorf("expected 2 creations, got %d", got)
+	}
+}
+
+func TestDefaultRESTClientFactory_ClientParallelWithInvalidate(t *testing.T) {
+	t.Parallel()
+
+	f := kube.NewDefaultRESTClientFactory(&countingRESTConfigFactory{}, nil, "")
+
+	groupVersions := [][2]string{{"", "v1"}, {"apps", "v1"}, {"batch", "v1"}, {"", ""}}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if i%10 == 0 {
+				f.Invalidate()
+
+				return
+			}
+
+			gv := groupVersions[i%len(groupVersions)]
+
+			clt, err := f.Client(gv[0], gv[1])
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if clt == nil {
+				t.Error("expected a client, got nil")
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
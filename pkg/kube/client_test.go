@@ -3,6 +3,7 @@
 package kube_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -16,6 +17,9 @@ import (
 	utiltesting "k8s.io/client-go/util/testing"
 	"k8s.io/kubectl/pkg/scheme"
 
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
 )
 
@@ -136,6 +140,27 @@ func TestNewRESTClientFactory_Request(t *testing.T) {
 			wantErr:    false,
 			wantErrMsg: "",
 		},
+		{
+			desc:       "group discovery",
+			url:        "https://api.kube-apiserver-proxy.dev/apis/apps",
+			want:       "/apis/apps",
+			wantErr:    false,
+			wantErrMsg: "",
+		},
+		{
+			desc:       "non-resource url",
+			url:        "https://api.kube-apiserver-proxy.dev/version",
+			want:       "/version",
+			wantErr:    false,
+			wantErrMsg: "",
+		},
+		{
+			desc:       "openapi",
+			url:        "https://api.kube-apiserver-proxy.dev/openapi/v3",
+			want:       "/openapi/v3",
+			wantErr:    false,
+			wantErrMsg: "",
+		},
 	}
 	for _, tC := range testCases {
 		tC := tC
@@ -188,6 +213,162 @@ func TestNewRESTClientFactory_Request(t *testing.T) {
 	}
 }
 
+func TestNewRESTClientFactory_RequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	headers := make(chan http.Header, 1)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer testServer.Close()
+
+	cfMock := kube.NewMockRESTConfigFactory(ctrl)
+	cfMock.
+		EXPECT().
+		New(gomock.Any()).
+		Return(&rest.Config{
+			Host:        testServer.URL,
+			BearerToken: "proxy-token",
+		}, nil)
+
+	f := kube.NewDefaultRESTClientFactory(
+		cfMock,
+		nil,
+		"",
+		kube.WithRequestHeaderPolicy(httpx.NewRequestHeaderPolicy(config.HeaderPolicy{
+			Allow: []string{"Content-Type", "Accept-Language", "Authorization"},
+			Add:   map[string]string{"X-Forwarded-By": "kube-apiserver-proxy"},
+		})),
+	)
+
+	req, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.dev/api/v1/pods", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "en")
+	req.Header.Set("Authorization", "Bearer client-token")
+	req.Header.Set("X-Custom", "custom")
+
+	got, err := f.Request(*req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := got.Do(req.Context()).Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := <-headers
+
+	want := map[string]string{
+		"Content-Type":    "application/json",
+		"Accept-Language": "en",
+		"Authorization":   "Bearer proxy-token",
+		"X-Custom":        "",
+		"X-Forwarded-By":  "kube-apiserver-proxy",
+	}
+
+	for k, v := range want {
+		if got := h.Get(k); got != v {
+			t.Errorf("header %s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestNewRESTClientFactory_RequestImpersonation(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	headers := make(chan http.Header, 1)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer testServer.Close()
+
+	cfMock := kube.NewMockRESTConfigFactory(ctrl)
+	cfMock.
+		EXPECT().
+		New(gomock.Any()).
+		Return(&rest.Config{Host: testServer.URL}, nil)
+
+	f := kube.NewDefaultRESTClientFactory(
+		cfMock,
+		nil,
+		"",
+		kube.WithImpersonation(config.Impersonation{Enabled: true, GroupsPrefix: "oidc:"}),
+	)
+
+	req, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.dev/api/v1/pods", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	// Impersonation headers sent by the client must never reach the apiserver.
+	req.Header.Set("Impersonate-User", "system:admin")
+
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+		Username: "jane",
+		Groups:   []string{"dev", auth.AuthenticatedGroup},
+	}))
+
+	got, err := f.Request(*req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := got.Do(req.Context()).Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := <-headers
+
+	if got, want := h.Values("Impersonate-User"), []string{"jane"}; !cmp.Equal(got, want) {
+		t.Errorf("expected Impersonate-User %v, got %v", want, got)
+	}
+
+	if got, want := h.Values("Impersonate-Group"), []string{"oidc:dev", auth.AuthenticatedGroup}; !cmp.Equal(got, want) {
+		t.Errorf("expected Impersonate-Group %v, got %v", want, got)
+	}
+}
+
+func TestNewRESTClientFactory_RequestAnonymousDenied(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := kube.NewDefaultRESTClientFactory(
+		kube.NewMockRESTConfigFactory(ctrl),
+		nil,
+		"",
+		kube.WithImpersonation(config.Impersonation{Enabled: true, Anonymous: kube.AnonymousPolicyDeny}),
+	)
+
+	req, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.dev/api/v1/pods", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if _, err := f.Request(*req); !errors.Is(err, kube.ErrAnonymousRequestDenied) {
+		t.Errorf("expected error %v, got %v", kube.ErrAnonymousRequestDenied, err)
+	}
+}
+
 func testServerEnv(t *testing.T, groupVersion schema.GroupVersion) (*httptest.Server, *utiltesting.FakeHandler, *metav1.Status) {
 	status := &metav1.Status{
 		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
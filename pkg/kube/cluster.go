@@ -0,0 +1,139 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+const ClusterPathPrefix = "/clusters/"
+
+//nolint:gochecknoglobals // constant
+var ClusterResource = schema.GroupResource{Resource: "clusters"}
+
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+type clusterKey struct{}
+
+// WithCluster returns a copy of the context carrying the name of the cluster the request is routed to.
+func WithCluster(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, clusterKey{}, name)
+}
+
+// ClusterFrom returns the name of the cluster stored in the context, if any.
+func ClusterFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(clusterKey{}).(string)
+
+	return name, ok && name != ""
+}
+
+// NewMultiClusterRESTClientFactory returns a factory routing the requests to the factory of the cluster
+// stored in their context, or to the one of the default cluster when they do not select any.
+func NewMultiClusterRESTClientFactory(
+	factories map[string]RESTClientFactory,
+	defaultCluster string,
+) *MultiClusterRESTClientFactory {
+	return &MultiClusterRESTClientFactory{
+		factories:      factories,
+		defaultCluster: defaultCluster,
+	}
+}
+
+// MultiClusterRESTClientFactory keeps a separate RESTClientFactory, and thus a separate client cache, per cluster.
+type MultiClusterRESTClientFactory struct {
+	factories      map[string]RESTClientFactory
+	defaultCluster string
+}
+
+func (m *MultiClusterRESTClientFactory) Client(group, version string) (*rest.RESTClient, error) {
+	f, err := m.factory(m.defaultCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Client(group, version)
+}
+
+func (m *MultiClusterRESTClientFactory) Request(r http.Request) (*rest.Request, error) {
+	name, ok := ClusterFrom(r.Context())
+	if !ok {
+		name = m.defaultCluster
+	}
+
+	f, err := m.factory(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Request(r)
+}
+
+// Invalidate drops the clients cached by the factories of all the clusters.
+func (m *MultiClusterRESTClientFactory) Invalidate() {
+	for _, f := range m.factories {
+		if i, ok := f.(Invalidator); ok {
+			i.Invalidate()
+		}
+	}
+}
+
+// CacheSize returns the number of clients cached by the factories of all the clusters.
+func (m *MultiClusterRESTClientFactory) CacheSize() int {
+	size := 0
+
+	for _, f := range m.factories {
+		if s, ok := f.(CacheSizer); ok {
+			size += s.CacheSize()
+		}
+	}
+
+	return size
+}
+
+// InvalidateCluster drops the clients cached by the factory of the given cluster.
+func (m *MultiClusterRESTClientFactory) InvalidateCluster(name string) {
+	if i, ok := m.factories[name].(Invalidator); ok {
+		i.Invalidate()
+	}
+}
+
+// Clusters returns the sorted names of the clusters served by the factory.
+func (m *MultiClusterRESTClientFactory) Clusters() []string {
+	names := make([]string, 0, len(m.factories))
+
+	for name := range m.factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// DefaultCluster returns the name of the cluster serving the requests that do not select one.
+func (m *MultiClusterRESTClientFactory) DefaultCluster() string {
+	return m.defaultCluster
+}
+
+// ClusterFactory returns the factory of the clients of the given cluster.
+func (m *MultiClusterRESTClientFactory) ClusterFactory(name string) (RESTClientFactory, error) {
+	return m.factory(name)
+}
+
+func (m *MultiClusterRESTClientFactory) factory(name string) (RESTClientFactory, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: no cluster selected and no default cluster configured", ErrUnknownCluster)
+	}
+
+	f, ok := m.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownCluster, name)
+	}
+
+	return f, nil
+}
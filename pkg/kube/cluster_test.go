@@ -0,0 +1,117 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestMultiClusterRESTClientFactory_Request(t *testing.T) {
+	t.Parallel()
+
+	servers := make(map[string]*httptest.Server)
+	factories := make(map[string]kube.RESTClientFactory)
+
+	for _, name := range []string{"prod", "dev"} {
+		name := name
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"cluster":"` + name + `"}`))
+		}))
+		t.Cleanup(srv.Close)
+
+		servers[name] = srv
+		factories[name] = kube.NewDefaultRESTClientFactory(staticRESTConfigFactory{host: srv.URL}, nil, "")
+	}
+
+	f := kube.NewMultiClusterRESTClientFactory(factories, "prod")
+
+	if diff := cmp.Diff([]string{"dev", "prod"}, f.Clusters()); diff != "" {
+		t.Errorf("unexpected clusters (-want +got):\n%s", diff)
+	}
+
+	testCases := []struct {
+		desc     string
+		cluster  string
+		wantHost string
+		wantErr  error
+	}{
+		{
+			desc:     "default cluster",
+			wantHost: servers["prod"].URL,
+		},
+		{
+			desc:     "selected cluster",
+			cluster:  "dev",
+			wantHost: servers["dev"].URL,
+		},
+		{
+			desc:    "unknown cluster",
+			cluster: "staging",
+			wantErr: kube.ErrUnknownCluster,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tC.cluster != "" {
+				ctx = kube.WithCluster(ctx, tC.cluster)
+			}
+
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://kasp.test/api/v1/pods", nil)
+			if err != nil {
+				t.Fatalf("cannot create request: %v", err)
+			}
+
+			req, err := f.Request(*r)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr != nil {
+				return
+			}
+
+			if want := tC.wantHost + "/api/v1/pods"; req.URL().String() != want {
+				t.Errorf("expected request url %s, got %s", want, req.URL())
+			}
+		})
+	}
+}
+
+func TestMultiClusterRESTClientFactory_WithoutDefault(t *testing.T) {
+	t.Parallel()
+
+	f := kube.NewMultiClusterRESTClientFactory(map[string]kube.RESTClientFactory{}, "")
+
+	r, err := http.NewRequest(http.MethodGet, "https://kasp.test/api/v1/pods", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+
+	if _, err := f.Request(*r); !errors.Is(err, kube.ErrUnknownCluster) {
+		t.Errorf("expected error %v, got %v", kube.ErrUnknownCluster, err)
+	}
+}
+
+type staticRESTConfigFactory struct {
+	host string
+}
+
+func (s staticRESTConfigFactory) New(string) (*rest.Config, error) {
+	return &rest.Config{Host: s.host}, nil
+}
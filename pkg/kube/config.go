@@ -5,6 +5,8 @@ import (
 
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
 )
 
 type RESTConfigFactory interface {
@@ -36,3 +38,41 @@ func (r *DefaultRESTConfigFactory) New(kubeconfigPath string) (*rest.Config, err
 
 	return config, nil
 }
+
+// NewClusterRESTConfigFactory returns a factory creating the configs of the given cluster, honoring its
+// kubeconfig context and falling back to the kubeconfig passed to New when the cluster does not set one.
+func NewClusterRESTConfigFactory(cluster config.Cluster) *ClusterRESTConfigFactory {
+	return &ClusterRESTConfigFactory{cluster: cluster}
+}
+
+type ClusterRESTConfigFactory struct {
+	cluster config.Cluster
+}
+
+func (c *ClusterRESTConfigFactory) New(kubeconfigPath string) (*rest.Config, error) {
+	if c.cluster.InCluster {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cannot create in cluster config for cluster '%s': %w", c.cluster.Name, err)
+		}
+
+		return cfg, nil
+	}
+
+	if c.cluster.Kubeconfig != "" {
+		kubeconfigPath = c.cluster.Kubeconfig
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigPath
+
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		&clientcmd.ConfigOverrides{CurrentContext: c.cluster.Context},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot build config for cluster '%s': %w", c.cluster.Name, err)
+	}
+
+	return cfg, nil
+}
@@ -3,9 +3,12 @@
 package kube_test
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
 )
 
@@ -28,3 +31,79 @@ func TestDefaultRESTConfigFactory_New_WithoutCluster(t *testing.T) {
 		t.Errorf("did not expect a config, got one: %+v", cfg)
 	}
 }
+
+func TestClusterRESTConfigFactory_New(t *testing.T) {
+	t.Parallel()
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+  - name: prod
+    cluster:
+      server: https://prod.kasp.test
+  - name: dev
+    cluster:
+      server: https://dev.kasp.test
+contexts:
+  - name: prod
+    context:
+      cluster: prod
+      user: admin
+  - name: dev
+    context:
+      cluster: dev
+      user: admin
+users:
+  - name: admin
+    user:
+      token: secret
+`), 0o600); err != nil {
+		t.Fatalf("cannot write kubeconfig: %v", err)
+	}
+
+	testCases := []struct {
+		desc     string
+		cluster  config.Cluster
+		path     string
+		wantHost string
+		wantErr  bool
+	}{
+		{
+			desc:     "current context of the given kubeconfig",
+			cluster:  config.Cluster{Name: "prod"},
+			path:     kubeconfig,
+			wantHost: "https://prod.kasp.test",
+		},
+		{
+			desc:     "context of the cluster kubeconfig",
+			cluster:  config.Cluster{Name: "dev", Kubeconfig: kubeconfig, Context: "dev"},
+			path:     "/does/not/exist",
+			wantHost: "https://dev.kasp.test",
+		},
+		{
+			desc:    "unknown context",
+			cluster: config.Cluster{Name: "staging", Context: "staging"},
+			path:    kubeconfig,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := kube.NewClusterRESTConfigFactory(tC.cluster).New(tC.path)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tC.wantErr, err)
+			}
+
+			if err == nil && cfg.Host != tC.wantHost {
+				t.Errorf("expected host %s, got %s", tC.wantHost, cfg.Host)
+			}
+		})
+	}
+}
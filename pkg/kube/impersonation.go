@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const (
+	AnonymousPolicyDeny           = "deny"
+	AnonymousPolicyImpersonate    = "impersonate"
+	AnonymousPolicyServiceAccount = "serviceAccount"
+
+	ImpersonateUserHeader        = "Impersonate-User"
+	ImpersonateGroupHeader       = "Impersonate-Group"
+	ImpersonateExtraHeaderPrefix = "Impersonate-Extra-"
+)
+
+var (
+	ErrAnonymousRequestDenied = errors.New("anonymous requests are not allowed")
+	ErrInvalidImpersonation   = errors.New("cannot impersonate the caller")
+)
+
+// ImpersonationHeaders returns the headers needed to impersonate the given identity, according to the config.
+// A nil header and no error are returned when the request must be performed with the proxy credentials.
+func ImpersonationHeaders(id *auth.Identity, conf config.Impersonation) (http.Header, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	if id.IsAnonymous() {
+		switch conf.Anonymous {
+		case AnonymousPolicyServiceAccount:
+			return nil, nil
+
+		case AnonymousPolicyImpersonate:
+			// The anonymous identity is set by the proxy itself, so its reserved names are not prefixed.
+			h := http.Header{}
+			h.Set(ImpersonateUserHeader, auth.AnonymousUser)
+			h.Add(ImpersonateGroupHeader, auth.UnauthenticatedGroup)
+
+			return h, nil
+
+		default:
+			return nil, ErrAnonymousRequestDenied
+		}
+	}
+
+	username := id.Username
+	if conf.UsernameClaim != "" {
+		s, ok := id.Claims[conf.UsernameClaim].(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%w: claim '%s' is missing or not a string", ErrInvalidImpersonation, conf.UsernameClaim)
+		}
+
+		username = s
+	}
+
+	groups := id.Groups
+	if conf.GroupsClaim != "" {
+		groups = append(stringValues(id.Claims[conf.GroupsClaim]), auth.AuthenticatedGroup)
+	}
+
+	h := http.Header{}
+
+	h.Set(ImpersonateUserHeader, conf.UsernamePrefix+username)
+
+	for _, g := range groups {
+		h.Add(ImpersonateGroupHeader, prefixedGroup(conf.GroupsPrefix, g))
+	}
+
+	for k, vv := range id.Extra {
+		for _, v := range vv {
+			h.Add(ImpersonateExtraHeaderPrefix+url.PathEscape(k), v)
+		}
+	}
+
+	for claim, key := range conf.ExtraClaims {
+		for _, v := range stringValues(id.Claims[claim]) {
+			h.Add(ImpersonateExtraHeaderPrefix+url.PathEscape(key), v)
+		}
+	}
+
+	return h, nil
+}
+
+// prefixedGroup adds the prefix to the group, unless it is the one added by the proxy to every authenticated caller.
+// Names taken from the claims are always prefixed, even the reserved ones such as "system:masters", as they would
+// otherwise grant the caller whatever the cluster grants to them.
+func prefixedGroup(prefix, group string) string {
+	if group == auth.AuthenticatedGroup {
+		return group
+	}
+
+	return prefix + group
+}
+
+func stringValues(v any) []string {
+	switch vv := v.(type) {
+	case string:
+		return []string{vv}
+
+	case []string:
+		return vv
+
+	case []any:
+		values := make([]string, 0, len(vv))
+
+		for _, s := range vv {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+
+	default:
+		return []string{}
+	}
+}
@@ -0,0 +1,128 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestImpersonationHeaders(t *testing.T) {
+	t.Parallel()
+
+	jane := &auth.Identity{
+		Username: "jane",
+		Groups:   []string{"dev", auth.AuthenticatedGroup},
+		Extra:    map[string][]string{"tenant": {"acme"}},
+		Claims: map[string]any{
+			"email": "jane@kube-apiserver-proxy.test",
+			"roles": []any{"admin", "viewer"},
+			"scope": "read write",
+		},
+	}
+
+	testCases := []struct {
+		desc    string
+		id      *auth.Identity
+		conf    config.Impersonation
+		want    http.Header
+		wantErr error
+	}{
+		{
+			desc: "disabled",
+			id:   jane,
+			conf: config.Impersonation{},
+			want: nil,
+		},
+		{
+			desc: "identity fields",
+			id:   jane,
+			conf: config.Impersonation{Enabled: true},
+			want: http.Header{
+				"Impersonate-User":         {"jane"},
+				"Impersonate-Group":        {"dev", auth.AuthenticatedGroup},
+				"Impersonate-Extra-Tenant": {"acme"},
+			},
+		},
+		{
+			desc: "claims and prefixes",
+			id:   jane,
+			conf: config.Impersonation{
+				Enabled:        true,
+				UsernameClaim:  "email",
+				GroupsClaim:    "roles",
+				UsernamePrefix: "oidc:",
+				GroupsPrefix:   "oidc:",
+				ExtraClaims:    map[string]string{"scope": "example.com/scopes"},
+			},
+			want: http.Header{
+				"Impersonate-User":                       {"oidc:jane@kube-apiserver-proxy.test"},
+				"Impersonate-Group":                      {"oidc:admin", "oidc:viewer", auth.AuthenticatedGroup},
+				"Impersonate-Extra-Tenant":               {"acme"},
+				"Impersonate-Extra-Example.com%2fscopes": {"read write"},
+			},
+		},
+		{
+			desc: "reserved names from claims",
+			id: &auth.Identity{
+				Username: "system:admin",
+				Groups:   []string{"system:masters", auth.AuthenticatedGroup},
+			},
+			conf: config.Impersonation{Enabled: true, UsernamePrefix: "oidc:", GroupsPrefix: "oidc:"},
+			want: http.Header{
+				"Impersonate-User":  {"oidc:system:admin"},
+				"Impersonate-Group": {"oidc:system:masters", auth.AuthenticatedGroup},
+			},
+		},
+		{
+			desc:    "missing username claim",
+			id:      jane,
+			conf:    config.Impersonation{Enabled: true, UsernameClaim: "preferred_username"},
+			wantErr: kube.ErrInvalidImpersonation,
+		},
+		{
+			desc:    "anonymous denied by default",
+			id:      nil,
+			conf:    config.Impersonation{Enabled: true},
+			wantErr: kube.ErrAnonymousRequestDenied,
+		},
+		{
+			desc: "anonymous impersonated",
+			id:   nil,
+			conf: config.Impersonation{Enabled: true, Anonymous: kube.AnonymousPolicyImpersonate, GroupsPrefix: "oidc:"},
+			want: http.Header{
+				"Impersonate-User":  {auth.AnonymousUser},
+				"Impersonate-Group": {auth.UnauthenticatedGroup},
+			},
+		},
+		{
+			desc: "anonymous served by the service account",
+			id:   nil,
+			conf: config.Impersonation{Enabled: true, Anonymous: kube.AnonymousPolicyServiceAccount},
+			want: nil,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := kube.ImpersonationHeaders(tC.id, tC.conf)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if diff := cmp.Diff(tC.want, got); diff != "" {
+				t.Errorf("headers mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+)
+
+type responseObserverKey struct{}
+
+// ResponseObserver gets notified about every response received from the apiserver.
+type ResponseObserver func(*http.Response)
+
+// WithResponseObserver returns a context that makes the transports wrapped by ObserveResponses
+// notify the given observer about the responses they receive, so that callers of rest.Request
+// can access details such as the headers that the rest client does not expose.
+func WithResponseObserver(ctx context.Context, observer ResponseObserver) context.Context {
+	return context.WithValue(ctx, responseObserverKey{}, observer)
+}
+
+// ObserveResponses wraps the given transport so that it honors the observers set via WithResponseObserver.
+// It is meant to be used as rest.Config.WrapTransport.
+func ObserveResponses(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &observingRoundTripper{rt: rt}
+}
+
+type observingRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (o *observingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := o.rt.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	if observer, ok := req.Context().Value(responseObserverKey{}).(ResponseObserver); ok && observer != nil {
+		observer(res)
+	}
+
+	return res, nil
+}
+
+// WrappedRoundTripper lets the helpers of client-go, such as utilnet.CloseIdleConnectionsFor, reach the transport.
+func (o *observingRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return o.rt
+}
@@ -0,0 +1,129 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+)
+
+const (
+	defaultPassthroughCacheSize = 256
+	defaultPassthroughCacheTTL  = 10 * time.Minute
+)
+
+var (
+	ErrMissingCredentials           = errors.New("no bearer token found in the request")
+	ErrClientCertificatePassthrough = errors.New(
+		"client certificates cannot be forwarded to the apiserver, use a bearer token instead",
+	)
+)
+
+// WithCredentialPassthrough makes the factory call the apiserver with the bearer token of the incoming request,
+// reusing only the host and the certificate authority of the rest config.
+func WithCredentialPassthrough(conf config.Passthrough) RESTClientFactoryOption {
+	return func(k *DefaultRESTClientFactory) {
+		size := conf.CacheSize
+		if size <= 0 {
+			size = defaultPassthroughCacheSize
+		}
+
+		if conf.CacheTTL <= 0 {
+			conf.CacheTTL = defaultPassthroughCacheTTL
+		}
+
+		k.passthrough = conf
+		k.tokenClients = cache.NewLRUExpireCache(size)
+	}
+}
+
+// tokenClients holds the clients created for a single bearer token: they share the same http client, created
+// once per token rather than once per request. The transport under it is shared by client-go with all the other
+// clients having the same TLS config, so its idle connections are not closed when the token clients are dropped.
+type tokenClients struct {
+	mu         sync.Mutex
+	config     *rest.Config
+	httpClient *http.Client
+	clients    map[string]*rest.RESTClient
+}
+
+func (k *DefaultRESTClientFactory) passthroughClient(r http.Request, group, version string) (*rest.RESTClient, error) {
+	token, ok := auth.BearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			return nil, ErrClientCertificatePassthrough
+		}
+
+		return nil, ErrMissingCredentials
+	}
+
+	tc, err := k.clientsForToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	key := group + "/" + version
+
+	if clt, ok := tc.clients[key]; ok {
+		return clt, nil
+	}
+
+	clt, err := restClientFor(withGroupVersion(rest.CopyConfig(tc.config), group, version), tc.httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rest client: %w", err)
+	}
+
+	tc.clients[key] = clt
+
+	return clt, nil
+}
+
+func (k *DefaultRESTClientFactory) clientsForToken(token string) (*tokenClients, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	k.tokenClientsMu.Lock()
+	defer k.tokenClientsMu.Unlock()
+
+	if tc, ok := k.tokenClients.Get(key); ok {
+		if tc, ok := tc.(*tokenClients); ok {
+			return tc, nil
+		}
+	}
+
+	base, err := k.restConfigFactory.New(k.kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rest config: %w", err)
+	}
+
+	cfg := rest.AnonymousClientConfig(base)
+	cfg.BearerToken = token
+	cfg.Wrap(ObserveResponses)
+
+	hc, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create http client: %w", err)
+	}
+
+	tc := &tokenClients{
+		config:     cfg,
+		httpClient: hc,
+		clients:    make(map[string]*rest.RESTClient),
+	}
+
+	k.tokenClients.Add(key, tc, k.passthrough.CacheTTL)
+
+	return tc, nil
+}
@@ -0,0 +1,127 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gomock "go.uber.org/mock/gomock"
+	"k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestNewRESTClientFactory_RequestPassthrough(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authorizations := make(chan string, 3)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations <- r.Header.Get("Authorization")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer testServer.Close()
+
+	cfMock := kube.NewMockRESTConfigFactory(ctrl)
+	cfMock.
+		EXPECT().
+		New(gomock.Any()).
+		Return(&rest.Config{Host: testServer.URL, BearerToken: "proxy-token"}, nil).
+		Times(2)
+
+	f := kube.NewDefaultRESTClientFactory(
+		cfMock,
+		nil,
+		"",
+		kube.WithCredentialPassthrough(config.Passthrough{Enabled: true, CacheSize: 8}),
+	)
+
+	for _, tc := range []struct {
+		token string
+		url   string
+	}{
+		{token: "alice-token", url: "https://api.kube-apiserver-proxy.dev/api/v1/pods"},
+		{token: "alice-token", url: "https://api.kube-apiserver-proxy.dev/apis/apps/v1/deployments"},
+		{token: "bob-token", url: "https://api.kube-apiserver-proxy.dev/api/v1/pods"},
+	} {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+
+		got, err := f.Request(*req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := got.Do(req.Context()).Error(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, want := <-authorizations, "Bearer "+tc.token; got != want {
+			t.Errorf("expected authorization %q, got %q", want, got)
+		}
+	}
+}
+
+func TestNewRESTClientFactory_RequestPassthroughWithoutCredentials(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := kube.NewDefaultRESTClientFactory(
+		kube.NewMockRESTConfigFactory(ctrl),
+		nil,
+		"",
+		kube.WithCredentialPassthrough(config.Passthrough{Enabled: true}),
+	)
+
+	testCases := []struct {
+		desc    string
+		tls     *tls.ConnectionState
+		wantErr error
+	}{
+		{
+			desc:    "no credentials",
+			tls:     nil,
+			wantErr: kube.ErrMissingCredentials,
+		},
+		{
+			desc:    "client certificate",
+			tls:     &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}},
+			wantErr: kube.ErrClientCertificatePassthrough,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.dev/api/v1/pods", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			req.TLS = tC.tls
+
+			if _, err := f.Request(*req); !errors.Is(err, tC.wantErr) {
+				t.Errorf("expected error %v, got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
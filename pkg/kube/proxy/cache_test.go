@@ -0,0 +1,61 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+type staticReadCache map[string][]byte
+
+func (c staticReadCache) Lookup(r *http.Request) ([]byte, bool) {
+	body, ok := c[r.URL.Path]
+
+	return body, ok
+}
+
+func TestHTTP_DoServeHTTP_ReadCache(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The apiserver is never called for the cached requests: the mock fails the test if it is.
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{
+			proxy.NewJqResponseBodyTransformer(),
+		},
+		proxy.WithReadCache(staticReadCache{
+			"/api/v1/namespaces/default/pods/web": []byte(`{"kind":"Pod","metadata":{"name":"web"}}`),
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web?jq=.metadata.name", nil)
+	w := httptest.NewRecorder()
+
+	if err := hp.DoServeHTTP(r.Context(), w, *r); err != nil {
+		t.Fatalf("did not expect an error, %v given", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if got, want := w.Body.String(), `"web"`; got != want {
+		t.Errorf("got = %s, want %s", got, want)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected a json content type, got %q", got)
+	}
+}
@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/utils/lru"
+)
+
+const (
+	// DefaultCELCostLimit bounds the cost of evaluating an expression, as the apiserver does for each
+	// validation rule, so that the clients cannot make the proxy spin on expensive expressions.
+	DefaultCELCostLimit uint64 = 1_000_000
+
+	// DefaultCELTotalCostLimit bounds the cost of all the evaluations done for a response, as the apiserver does
+	// for each request, so that filtering long lists cannot add up to an unbounded cost.
+	DefaultCELTotalCostLimit uint64 = 10_000_000
+
+	// MaxCELExpressionLength bounds the size of the expressions, to limit the cost of their compilation.
+	MaxCELExpressionLength = 4096
+
+	// celObject is the variable holding the response, or the list item being filtered.
+	celObject = "object"
+
+	// celProgramCacheSize bounds the number of compiled expressions kept around.
+	celProgramCacheSize = 256
+)
+
+var (
+	ErrCELCostBudgetExceeded = errors.New("cel cost budget exceeded")
+	ErrCELExpressionTooLong  = errors.New("cel expression is too long")
+	ErrCELFilterNotBool      = errors.New("cel filter must evaluate to a bool")
+	ErrCELResultNotJSON      = errors.New("cel result cannot be converted to json")
+	ErrNotAList              = errors.New("response is not a list")
+)
+
+type CELOption func(*celEvaluator)
+
+// WithCELCostLimit overrides the DefaultCELCostLimit of each evaluation.
+func WithCELCostLimit(limit uint64) CELOption {
+	return func(e *celEvaluator) {
+		e.costLimit = limit
+	}
+}
+
+// WithCELTotalCostLimit overrides the DefaultCELTotalCostLimit of all the evaluations done for a response.
+func WithCELTotalCostLimit(limit uint64) CELOption {
+	return func(e *celEvaluator) {
+		e.totalCostLimit = limit
+	}
+}
+
+func NewCELResponseBodyTransformer(opts ...CELOption) *CELResponseBodyTransformer {
+	return &CELResponseBodyTransformer{evaluator: newCELEvaluator(opts...)}
+}
+
+// CELResponseBodyTransformer replaces the response with the result of a CEL expression evaluated against it,
+// e.g. `object.items.map(i, i.metadata.name)`.
+type CELResponseBodyTransformer struct {
+	evaluator *celEvaluator
+}
+
+func (c *CELResponseBodyTransformer) Name() string {
+	return "cel"
+}
+
+func (c *CELResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]byte, error) {
+	src, _ := opts["src"].(string)
+
+	prg, err := c.evaluator.compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := prg.Eval(map[string]any{celObject: obj})
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := celToJSON(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+func NewCELFilterResponseBodyTransformer(opts ...CELOption) *CELFilterResponseBodyTransformer {
+	return &CELFilterResponseBodyTransformer{evaluator: newCELEvaluator(opts...)}
+}
+
+// CELFilterResponseBodyTransformer drops the items of a list response for which a CEL predicate is false,
+// e.g. `object.status.phase != 'Running'`, leaving the rest of the list untouched.
+// As it only applies to lists, it cannot transform the objects of the watch events.
+type CELFilterResponseBodyTransformer struct {
+	evaluator *celEvaluator
+}
+
+func (c *CELFilterResponseBodyTransformer) Name() string {
+	return "celFilter"
+}
+
+func (c *CELFilterResponseBodyTransformer) ListsOnly() bool {
+	return true
+}
+
+func (c *CELFilterResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]byte, error) {
+	src, _ := opts["src"].(string)
+
+	prg, err := c.evaluator.compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.(map[string]any)
+	if !ok {
+		return nil, ErrNotAList
+	}
+
+	items, ok := list["items"].([]any)
+	if !ok {
+		return nil, ErrNotAList
+	}
+
+	kept := make([]any, 0, len(items))
+
+	var cost uint64
+
+	for _, item := range items {
+		out, details, err := prg.Eval(map[string]any{celObject: item})
+		if err != nil {
+			return nil, err
+		}
+
+		if actual := details.ActualCost(); actual != nil {
+			cost += *actual
+		}
+
+		if cost > c.evaluator.totalCostLimit {
+			return nil, fmt.Errorf("%w: %d, at most %d allowed", ErrCELCostBudgetExceeded, cost,
+				c.evaluator.totalCostLimit)
+		}
+
+		match, ok := out.(types.Bool)
+		if !ok {
+			return nil, fmt.Errorf("%w, got %s", ErrCELFilterNotBool, out.Type().TypeName())
+		}
+
+		if match {
+			kept = append(kept, item)
+		}
+	}
+
+	list["items"] = kept
+
+	return json.Marshal(list)
+}
+
+func newCELEvaluator(opts ...CELOption) *celEvaluator {
+	e := &celEvaluator{
+		costLimit:      DefaultCELCostLimit,
+		totalCostLimit: DefaultCELTotalCostLimit,
+		programs:       lru.New(celProgramCacheSize),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	// The environment is the expensive part of the compilation, it is shared by all the expressions.
+	e.env, e.envErr = cel.NewEnv(
+		cel.Variable(celObject, cel.DynType),
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+	)
+
+	return e
+}
+
+type celEvaluator struct {
+	costLimit      uint64
+	totalCostLimit uint64
+	env            *cel.Env
+	envErr         error
+	// programs caches the compiled expressions by source, as the named transforms run the same ones over and over.
+	programs *lru.Cache
+}
+
+func (e *celEvaluator) compile(src string) (cel.Program, error) {
+	if len(src) > MaxCELExpressionLength {
+		return nil, fmt.Errorf("%w: %d characters, at most %d allowed", ErrCELExpressionTooLong, len(src),
+			MaxCELExpressionLength)
+	}
+
+	if e.envErr != nil {
+		return nil, e.envErr
+	}
+
+	if prg, ok := e.programs.Get(src); ok {
+		if prg, ok := prg.(cel.Program); ok {
+			return prg, nil
+		}
+	}
+
+	ast, iss := e.env.Compile(src)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	prg, err := e.env.Program(ast, cel.CostLimit(e.costLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	e.programs.Add(src, prg)
+
+	return prg, nil
+}
+
+// celToJSON converts the result of an expression into a value that json.Marshal renders faithfully: unlike
+// the conversion to structpb.Value, it keeps the integers as such rather than turning them into float64.
+//
+//nolint:cyclop // one case per CEL type
+func celToJSON(v ref.Val) (any, error) {
+	switch vv := v.(type) {
+	case types.Null:
+		return nil, nil //nolint:nilnil // json null
+
+	case types.Bool:
+		return bool(vv), nil
+
+	case types.Int:
+		return int64(vv), nil
+
+	case types.Uint:
+		return uint64(vv), nil
+
+	case types.Double:
+		return float64(vv), nil
+
+	case types.String:
+		return string(vv), nil
+
+	case traits.Lister:
+		out := make([]any, 0)
+
+		for it := vv.Iterator(); it.HasNext() == types.True; {
+			e, err := celToJSON(it.Next())
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, e)
+		}
+
+		return out, nil
+
+	case traits.Mapper:
+		out := make(map[string]any)
+
+		for it := vv.Iterator(); it.HasNext() == types.True; {
+			k := it.Next()
+
+			key, ok := k.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("%w: map key of type %s", ErrCELResultNotJSON, k.Type().TypeName())
+			}
+
+			e, err := celToJSON(vv.Get(k))
+			if err != nil {
+				return nil, err
+			}
+
+			out[string(key)] = e
+		}
+
+		return out, nil
+	}
+
+	// The other types, such as timestamps and durations, are rendered as in their protobuf json mapping.
+	nv, err := v.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, err
+	}
+
+	pv, ok := nv.(*structpb.Value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrCELResultNotJSON, nv)
+	}
+
+	return pv.AsInterface(), nil
+}
+
+// decodeJSON decodes the integers as int64 rather than float64, as the apiserver does for unstructured objects,
+// so that CEL expressions can compare them with integer literals.
+func decodeJSON(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v any) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, e := range vv {
+			vv[k] = convertNumbers(e)
+		}
+
+	case []any:
+		for i, e := range vv {
+			vv[i] = convertNumbers(e)
+		}
+
+	case json.Number:
+		if i, err := vv.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := vv.Float64()
+
+		return f
+	}
+
+	return v
+}
@@ -0,0 +1,154 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+var celTestBody = []byte(`{"kind":"PodList","metadata":{"resourceVersion":"42"},"items":[` +
+	`{"metadata":{"name":"web-0"},"spec":{"priority":1},"status":{"phase":"Running"}},` +
+	`{"metadata":{"name":"web-1"},"spec":{"priority":10},"status":{"phase":"Pending"}}]}`)
+
+func TestCELResponseBodyTransformer_Run(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc    string
+		tf      proxy.ResponseBodyTransformer
+		src     string
+		want    string
+		wantErr error
+	}{
+		{
+			desc: "expression",
+			tf:   proxy.NewCELResponseBodyTransformer(),
+			src:  "object.items.map(i, i.metadata.name)",
+			want: `["web-0","web-1"]`,
+		},
+		{
+			desc: "map",
+			tf:   proxy.NewCELResponseBodyTransformer(),
+			src:  `{"count": size(object.items), "kind": object.kind}`,
+			want: `{"count":2,"kind":"PodList"}`,
+		},
+		{
+			desc: "filter",
+			tf:   proxy.NewCELFilterResponseBodyTransformer(),
+			src:  "object.status.phase != 'Running'",
+			want: `{"items":[{"metadata":{"name":"web-1"},"spec":{"priority":10},"status":{"phase":"Pending"}}],` +
+				`"kind":"PodList","metadata":{"resourceVersion":"42"}}`,
+		},
+		{
+			desc: "filter comparing integers",
+			tf:   proxy.NewCELFilterResponseBodyTransformer(),
+			src:  "object.spec.priority < 5",
+			want: `{"items":[{"metadata":{"name":"web-0"},"spec":{"priority":1},"status":{"phase":"Running"}}],` +
+				`"kind":"PodList","metadata":{"resourceVersion":"42"}}`,
+		},
+		{
+			desc:    "filter not returning a bool",
+			tf:      proxy.NewCELFilterResponseBodyTransformer(),
+			src:     "object.metadata.name",
+			wantErr: proxy.ErrCELFilterNotBool,
+		},
+		{
+			desc:    "expression too long",
+			tf:      proxy.NewCELResponseBodyTransformer(),
+			src:     "object.kind" + strings.Repeat(" ", proxy.MaxCELExpressionLength),
+			wantErr: proxy.ErrCELExpressionTooLong,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := tC.tf.Run(celTestBody, map[string]any{"src": tC.src})
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if string(res) != tC.want {
+				t.Errorf("wanted %s, got %s", tC.want, res)
+			}
+		})
+	}
+}
+
+func TestCELFilterResponseBodyTransformer_NotAList(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewCELFilterResponseBodyTransformer()
+
+	_, err := tf.Run([]byte(`{"kind":"Pod","metadata":{"name":"web-0"}}`), map[string]any{"src": "true"})
+	if !errors.Is(err, proxy.ErrNotAList) {
+		t.Errorf("expected error %v, got %v", proxy.ErrNotAList, err)
+	}
+}
+
+func TestCELResponseBodyTransformer_CostLimit(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewCELResponseBodyTransformer(proxy.WithCELCostLimit(10))
+
+	src := "object.items.map(i, object.items.map(j, i.metadata.name + j.metadata.name))"
+
+	if _, err := tf.Run(celTestBody, map[string]any{"src": src}); err == nil {
+		t.Error("expected the cost limit to be exceeded, got no error")
+	}
+
+	if _, err := proxy.NewCELResponseBodyTransformer().Run(celTestBody, map[string]any{"src": src}); err != nil {
+		t.Errorf("did not expect an error with the default cost limit, got %v", err)
+	}
+}
+
+func TestCELFilterResponseBodyTransformer_TotalCostLimit(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewCELFilterResponseBodyTransformer(proxy.WithCELTotalCostLimit(3))
+
+	src := "object.metadata.name.startsWith('web')"
+
+	if _, err := tf.Run(celTestBody, map[string]any{"src": src}); !errors.Is(err, proxy.ErrCELCostBudgetExceeded) {
+		t.Errorf("expected error %v, got %v", proxy.ErrCELCostBudgetExceeded, err)
+	}
+
+	if _, err := proxy.NewCELFilterResponseBodyTransformer().Run(celTestBody, map[string]any{"src": src}); err != nil {
+		t.Errorf("did not expect an error with the default total cost limit, got %v", err)
+	}
+}
+
+func TestCELResponseBodyTransformer_InvalidExpression(t *testing.T) {
+	t.Parallel()
+
+	if _, err := proxy.NewCELResponseBodyTransformer().Run(celTestBody, map[string]any{"src": "object."}); err == nil {
+		t.Error("expected an error, got none")
+	}
+}
+
+func TestCELResponseBodyTransformer_LargeIntegers(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewCELResponseBodyTransformer()
+
+	body := []byte(`{"spec":{"replicas":9007199254740993,"ratio":0.5,"labels":{"app":"web"},"paused":null}}`)
+
+	// The same expression runs twice, the second time from the compiled programs cache.
+	for i := 0; i < 2; i++ {
+		res, err := tf.Run(body, map[string]any{"src": "object.spec"})
+		if err != nil {
+			t.Fatalf("did not expect an error, got %v", err)
+		}
+
+		want := `{"labels":{"app":"web"},"paused":null,"ratio":0.5,"replicas":9007199254740993}`
+		if string(res) != want {
+			t.Errorf("wanted %s, got %s", want, res)
+		}
+	}
+}
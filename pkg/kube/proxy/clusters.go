@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+type ClusterLister interface {
+	Clusters() []string
+	DefaultCluster() string
+}
+
+type Cluster struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default,omitempty"`
+}
+
+type ClusterList struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+// NewClustersHandler returns a handler listing the clusters that requests can be routed to.
+func NewClustersHandler(lister ClusterLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			kube.WriteStatus(w, apierrors.NewMethodNotSupported(kube.ClusterResource, r.Method).Status())
+
+			return
+		}
+
+		list := ClusterList{Clusters: make([]Cluster, 0)}
+
+		for _, name := range lister.Clusters() {
+			list.Clusters = append(list.Clusters, Cluster{Name: name, Default: name == lister.DefaultCluster()})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			slog.Error("cannot encode cluster list", "error", err)
+		}
+	})
+}
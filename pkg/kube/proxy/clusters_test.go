@@ -0,0 +1,51 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestClustersHandler(t *testing.T) {
+	t.Parallel()
+
+	lister := kube.NewMultiClusterRESTClientFactory(map[string]kube.RESTClientFactory{
+		"prod": nil,
+		"dev":  nil,
+	}, "prod")
+
+	rec := httptest.NewRecorder()
+
+	proxy.NewClustersHandler(lister).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/clusters", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var got proxy.ClusterList
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("cannot decode cluster list: %v", err)
+	}
+
+	want := proxy.ClusterList{Clusters: []proxy.Cluster{{Name: "dev"}, {Name: "prod", Default: true}}}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected cluster list (-want +got):\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+
+	proxy.NewClustersHandler(lister).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/clusters", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
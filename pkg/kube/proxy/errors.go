@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+// responseStartedErrors are returned after the status code and part of the body have already been sent.
+var responseStartedErrors = []error{
+	ErrCannotDecodeWatchEvent,
+	ErrCannotEncodeWatchEvent,
+	ErrCannotFlushWatchEvent,
+	ErrCannotTransformWatchItem,
+	ErrCannotWriteResponseBody,
+}
+
+// WriteError renders the error returned by DoServeHTTP as a metav1.Status, unless the response has already
+// been started, in which case there is nothing meaningful left to tell the client.
+func WriteError(w http.ResponseWriter, err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	for _, e := range responseStartedErrors {
+		if errors.Is(err, e) {
+			return
+		}
+	}
+
+	kube.WriteStatus(w, ErrorStatus(err))
+}
+
+// ErrorStatus maps the errors returned by DoServeHTTP to the status object returned to the client.
+func ErrorStatus(err error) metav1.Status {
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		return apiStatus.Status()
+	}
+
+	switch {
+	case errors.Is(err, kube.ErrUnknownCluster):
+		return metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonNotFound,
+			Code:    http.StatusNotFound,
+		}
+
+	case errors.Is(err, kube.ErrAnonymousRequestDenied),
+		errors.Is(err, kube.ErrMissingCredentials),
+		errors.Is(err, kube.ErrClientCertificatePassthrough):
+		return apierrors.NewUnauthorized(err.Error()).Status()
+
+	case errors.Is(err, kube.ErrInvalidImpersonation):
+		return apierrors.NewForbidden(schema.GroupResource{}, "", err).Status()
+
+	case errors.Is(err, ErrAdHocTransformsDisabled), errors.Is(err, ErrAdHocTemplatesDisabled):
+		return apierrors.NewForbidden(schema.GroupResource{}, "", err).Status()
+
+	case errors.Is(err, ErrCannotApplyResponseTransformers), errors.Is(err, ErrCannotParseRequestURI):
+		return apierrors.NewBadRequest(err.Error()).Status()
+
+	case errors.Is(err, ErrCannotGetProxiedResponseBody), errors.Is(err, ErrCannotOpenWatchStream):
+		return metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonServiceUnavailable,
+			Code:    http.StatusBadGateway,
+		}
+
+	case errors.Is(err, ErrCannotCreateRESTClient):
+		return apierrors.NewServiceUnavailable(err.Error()).Status()
+
+	default:
+		return apierrors.NewInternalError(err).Status()
+	}
+}
@@ -0,0 +1,156 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc       string
+		err        error
+		wantCode   int32
+		wantReason metav1.StatusReason
+	}{
+		{
+			desc:       "anonymous request denied",
+			err:        fmt.Errorf("%w: %w", proxy.ErrCannotCreateRESTClient, kube.ErrAnonymousRequestDenied),
+			wantCode:   http.StatusUnauthorized,
+			wantReason: metav1.StatusReasonUnauthorized,
+		},
+		{
+			desc:       "unknown cluster",
+			err:        fmt.Errorf("%w: %w", proxy.ErrCannotCreateRESTClient, kube.ErrUnknownCluster),
+			wantCode:   http.StatusNotFound,
+			wantReason: metav1.StatusReasonNotFound,
+		},
+		{
+			desc:       "rest client creation failure",
+			err:        fmt.Errorf("%w: %w", proxy.ErrCannotCreateRESTClient, errors.New("no kubeconfig")),
+			wantCode:   http.StatusServiceUnavailable,
+			wantReason: metav1.StatusReasonServiceUnavailable,
+		},
+		{
+			desc:       "transformer failure",
+			err:        fmt.Errorf("%w: %w", proxy.ErrCannotApplyResponseTransformers, errors.New("invalid jq")),
+			wantCode:   http.StatusBadRequest,
+			wantReason: metav1.StatusReasonBadRequest,
+		},
+		{
+			desc: "ad-hoc transformation disabled",
+			err: fmt.Errorf(
+				"%w: %w",
+				proxy.ErrCannotApplyResponseTransformers,
+				proxy.ErrAdHocTransformsDisabled,
+			),
+			wantCode:   http.StatusForbidden,
+			wantReason: metav1.StatusReasonForbidden,
+		},
+		{
+			desc: "ad-hoc go template disabled",
+			err: fmt.Errorf(
+				"%w: %w",
+				proxy.ErrCannotApplyResponseTransformers,
+				proxy.ErrAdHocTemplatesDisabled,
+			),
+			wantCode:   http.StatusForbidden,
+			wantReason: metav1.StatusReasonForbidden,
+		},
+		{
+			desc:       "apiserver unreachable",
+			err:        fmt.Errorf("%w: %w", proxy.ErrCannotGetProxiedResponseBody, errors.New("connection refused")),
+			wantCode:   http.StatusBadGateway,
+			wantReason: metav1.StatusReasonServiceUnavailable,
+		},
+		{
+			desc: "apiserver status while opening a watch",
+			err: fmt.Errorf(
+				"%w: %w",
+				proxy.ErrCannotOpenWatchStream,
+				apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "foo"),
+			),
+			wantCode:   http.StatusNotFound,
+			wantReason: metav1.StatusReasonNotFound,
+		},
+		{
+			desc:       "unknown error",
+			err:        errors.New("boom"),
+			wantCode:   http.StatusInternalServerError,
+			wantReason: metav1.StatusReasonInternalError,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got := proxy.ErrorStatus(tC.err)
+
+			if got.Code != tC.wantCode {
+				t.Errorf("expected code %d, got %d", tC.wantCode, got.Code)
+			}
+
+			if got.Reason != tC.wantReason {
+				t.Errorf("expected reason %s, got %s", tC.wantReason, got.Reason)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc     string
+		err      error
+		wantCode int
+		wantBody bool
+	}{
+		{
+			desc:     "proxy failure",
+			err:      fmt.Errorf("%w: %w", proxy.ErrCannotApplyResponseTransformers, errors.New("invalid jq")),
+			wantCode: http.StatusBadRequest,
+			wantBody: true,
+		},
+		{
+			desc:     "response already started",
+			err:      fmt.Errorf("%w: %w", proxy.ErrCannotWriteResponseBody, errors.New("broken pipe")),
+			wantCode: http.StatusOK,
+			wantBody: false,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+
+			proxy.WriteError(w, tC.err)
+
+			if w.Code != tC.wantCode {
+				t.Errorf("expected code %d, got %d", tC.wantCode, w.Code)
+			}
+
+			if got := w.Body.Len() > 0; got != tC.wantBody {
+				t.Errorf("expected body: %v, got: %v", tC.wantBody, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"text/template"
+)
+
+const (
+	// GoTemplateOutputParam is the query parameter selecting the output of the gotemplate transformer.
+	GoTemplateOutputParam = "gotemplateOutput"
+
+	GoTemplateOutputText = "text"
+	GoTemplateOutputJSON = "json"
+
+	// DefaultGoTemplateOutputLimit bounds the size of the rendered templates, so that the clients cannot make
+	// the proxy allocate unbounded amounts of memory, e.g. with nested repeat calls.
+	DefaultGoTemplateOutputLimit = 16 << 20
+)
+
+var (
+	ErrGoTemplateOutputTooLarge = errors.New("gotemplate output is too large")
+	ErrUnknownGoTemplateOutput  = errors.New("unknown gotemplate output, expected text or json")
+)
+
+type GoTemplateOption func(*GoTemplateResponseBodyTransformer)
+
+// WithGoTemplateOutputLimit overrides the DefaultGoTemplateOutputLimit, in bytes.
+func WithGoTemplateOutputLimit(limit int) GoTemplateOption {
+	return func(gt *GoTemplateResponseBodyTransformer) {
+		gt.outputLimit = limit
+	}
+}
+
+func NewGoTemplateResponseBodyTransformer(opts ...GoTemplateOption) *GoTemplateResponseBodyTransformer {
+	gt := &GoTemplateResponseBodyTransformer{outputLimit: DefaultGoTemplateOutputLimit}
+
+	for _, opt := range opts {
+		opt(gt)
+	}
+
+	return gt
+}
+
+// GoTemplateResponseBodyTransformer renders the response with a text/template, e.g. for shell scripts or
+// status pages, along with a set of sprig-like helper functions. The "output" option sets the content type
+// of the result: text by default, or json for templates producing json. Rendering fails as soon as the output
+// exceeds the configured limit.
+type GoTemplateResponseBodyTransformer struct {
+	outputLimit int
+}
+
+func (gt *GoTemplateResponseBodyTransformer) Name() string {
+	return "gotemplate"
+}
+
+func (gt *GoTemplateResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]byte, error) {
+	if _, err := goTemplateOutput(opts); err != nil {
+		return nil, err
+	}
+
+	src, _ := opts["src"].(string)
+
+	tpl, err := template.New(gt.Name()).Funcs(templateFuncs(gt.outputLimit)).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := limitedBuffer{limit: gt.outputLimit}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gt *GoTemplateResponseBodyTransformer) QueryOptions(q url.Values) map[string]any {
+	return map[string]any{"output": q.Get(GoTemplateOutputParam)}
+}
+
+func (gt *GoTemplateResponseBodyTransformer) ContentType(opts map[string]any) string {
+	if output, err := goTemplateOutput(opts); err == nil && output == GoTemplateOutputJSON {
+		return ContentTypeJSON
+	}
+
+	return ContentTypeText
+}
+
+func goTemplateOutput(opts map[string]any) (string, error) {
+	output, _ := opts["output"].(string)
+
+	switch output {
+	case "", GoTemplateOutputText:
+		return GoTemplateOutputText, nil
+
+	case GoTemplateOutputJSON:
+		return GoTemplateOutputJSON, nil
+
+	default:
+		return "", fmt.Errorf("%w: '%s'", ErrUnknownGoTemplateOutput, output)
+	}
+}
+
+// limitedBuffer is a bytes.Buffer refusing to grow past its limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrGoTemplateOutputTooLarge, b.limit)
+	}
+
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,159 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestGoTemplateResponseBodyTransformer_Run(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewGoTemplateResponseBodyTransformer()
+
+	body := []byte(`{"kind":"PodList","items":[` +
+		`{"metadata":{"name":"web-0","labels":{"app":"web","tier":"front"}},"spec":{"replicas":3}},` +
+		`{"metadata":{"name":"web-1"},"status":{"phase":"Pending"}}]}`)
+
+	testCases := []struct {
+		desc    string
+		src     string
+		output  string
+		want    string
+		wantErr error
+	}{
+		{
+			desc: "range",
+			src:  `{{range .items}}{{.metadata.name}}{{"\n"}}{{end}}`,
+			want: "web-0\nweb-1\n",
+		},
+		{
+			desc: "string helpers",
+			src:  `{{range .items}}{{.metadata.name | upper | trimPrefix "WEB-" | quote}} {{end}}`,
+			want: `"0" "1" `,
+		},
+		{
+			desc: "default",
+			src:  `{{range .items}}{{.status.phase | default "Unknown"}} {{end}}`,
+			want: "Unknown Pending ",
+		},
+		{
+			desc: "integers",
+			src:  `{{(index .items 0).spec.replicas | add 1}}`,
+			want: "4",
+		},
+		{
+			desc: "collections",
+			src:  `{{(first .items).metadata.labels | keys | join ","}} {{(last .items).metadata.name}}`,
+			want: "app,tier web-1",
+		},
+		{
+			desc:   "json",
+			src:    `{"count":{{len .items}},"first":{{(first .items).metadata.name | toJson}}}`,
+			output: proxy.GoTemplateOutputJSON,
+			want:   `{"count":2,"first":"web-0"}`,
+		},
+		{
+			desc: "repeat and indent",
+			src:  `{{"ab" | repeat 2}}{{"x\ny" | nindent 2}}`,
+			want: "abab\n  x\n  y",
+		},
+		{
+			desc:    "repeat count out of range",
+			src:     `{{"a" | repeat 100000}}`,
+			wantErr: proxy.ErrTemplateCountOutOfRange,
+		},
+		{
+			desc:    "negative indent",
+			src:     `{{"a" | indent -1}}`,
+			wantErr: proxy.ErrTemplateCountOutOfRange,
+		},
+		{
+			desc:    "nested repeat",
+			src:     `{{"0123456789" | repeat 1000 | repeat 1000 | repeat 1000}}`,
+			wantErr: proxy.ErrGoTemplateOutputTooLarge,
+		},
+		{
+			desc:    "replace blowing up",
+			src:     `{{"0123456789" | repeat 1000 | replace "" ("0123456789" | repeat 1000)}}`,
+			wantErr: proxy.ErrGoTemplateOutputTooLarge,
+		},
+		{
+			desc:    "unknown output",
+			src:     `{{.kind}}`,
+			output:  "html",
+			wantErr: proxy.ErrUnknownGoTemplateOutput,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := tf.Run(body, map[string]any{"src": tC.src, "output": tC.output})
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if string(res) != tC.want {
+				t.Errorf("wanted %q, got %q", tC.want, res)
+			}
+		})
+	}
+}
+
+func TestGoTemplateResponseBodyTransformer_OutputLimit(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewGoTemplateResponseBodyTransformer(proxy.WithGoTemplateOutputLimit(10))
+
+	src := `{{range .items}}{{.}}{{end}}`
+
+	_, err := tf.Run([]byte(`{"items":["0123","4567","89ab"]}`), map[string]any{"src": src})
+	if !errors.Is(err, proxy.ErrGoTemplateOutputTooLarge) {
+		t.Errorf("expected error %v, got %v", proxy.ErrGoTemplateOutputTooLarge, err)
+	}
+
+	res, err := tf.Run([]byte(`{"items":["0123","4567"]}`), map[string]any{"src": src})
+	if err != nil {
+		t.Fatalf("did not expect an error within the limit, got %v", err)
+	}
+
+	if string(res) != "01234567" {
+		t.Errorf("wanted %q, got %q", "01234567", res)
+	}
+}
+
+func TestGoTemplateResponseBodyTransformer_InvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewGoTemplateResponseBodyTransformer()
+
+	if _, err := tf.Run([]byte(`{}`), map[string]any{"src": "{{range .items}}"}); err == nil {
+		t.Error("expected an error, got none")
+	}
+
+	if _, err := tf.Run([]byte(`{}`), map[string]any{"src": `{{env "HOME"}}`}); err == nil {
+		t.Error("expected env not to be available, got no error")
+	}
+}
+
+func TestGoTemplateResponseBodyTransformer_ContentType(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewGoTemplateResponseBodyTransformer()
+
+	if got := tf.ContentType(tf.QueryOptions(url.Values{})); got != proxy.ContentTypeText {
+		t.Errorf("expected %q, got %q", proxy.ContentTypeText, got)
+	}
+
+	opts := tf.QueryOptions(url.Values{proxy.GoTemplateOutputParam: []string{proxy.GoTemplateOutputJSON}})
+	if got := tf.ContentType(opts); got != proxy.ContentTypeJSON {
+		t.Errorf("expected %q, got %q", proxy.ContentTypeJSON, got)
+	}
+}
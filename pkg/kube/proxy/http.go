@@ -4,11 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"net/url"
+	"time"
 
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+	"github.com/omissis/kube-apiserver-proxy/pkg/tracing"
 )
 
 var (
@@ -22,28 +33,84 @@ var (
 	ErrResponseWriterIsNil             = errors.New("response writer is nil")
 )
 
-func NewHTTP(restClientFactory kube.RESTClientFactory, responseTransformers []ResponseBodyTransformer) *HTTP {
-	return &HTTP{
+type HTTPOption func(*HTTP)
+
+// WithResponseHeaderPolicy sets the policy deciding which headers of the apiserver response are passed back.
+func WithResponseHeaderPolicy(policy httpx.HeaderPolicy) HTTPOption {
+	return func(h *HTTP) {
+		h.responseHeaders = policy
+	}
+}
+
+// WithTracerProvider sets the provider of the spans covering the apiserver calls and the transformers.
+func WithTracerProvider(tp trace.TracerProvider) HTTPOption {
+	return func(h *HTTP) {
+		h.tracer = tracing.Tracer(tp)
+	}
+}
+
+// WithDrain makes the proxy end the open watch streams once drain is closed, so that a server shutting down
+// does not wait for them until its grace period expires: clients are expected to re-establish them against
+// another replica.
+func WithDrain(drain <-chan struct{}) HTTPOption {
+	return func(h *HTTP) {
+		h.drain = drain
+	}
+}
+
+// ReadCache answers some of the requests from a local copy of the resources, without calling the apiserver.
+type ReadCache interface {
+	// Lookup returns the json body answering the request, or false when the request must go to the apiserver.
+	Lookup(r *http.Request) ([]byte, bool)
+}
+
+// WithReadCache makes the proxy look the requests up in the given cache before sending them to the apiserver.
+// The response transformers apply to the cached responses too.
+func WithReadCache(c ReadCache) HTTPOption {
+	return func(h *HTTP) {
+		h.cache = c
+	}
+}
+
+func NewHTTP(
+	restClientFactory kube.RESTClientFactory,
+	responseTransformers []ResponseBodyTransformer,
+	opts ...HTTPOption,
+) *HTTP {
+	h := &HTTP{
 		restClientFactory:    restClientFactory,
 		responseTransformers: responseTransformers,
+		responseHeaders:      httpx.NewResponseHeaderPolicy(config.HeaderPolicy{}),
+		tracer:               tracing.Tracer(nil),
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
 }
 
 type HTTP struct {
 	responseTransformers []ResponseBodyTransformer
 	restClientFactory    kube.RESTClientFactory
+	responseHeaders      httpx.HeaderPolicy
+	tracer               trace.Tracer
+	drain                <-chan struct{}
+	cache                ReadCache
+	transforms           transformCatalog
 }
 
 // ServeHTTP implements http.Handler interface
 func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r == nil {
-		log.Printf("error: no request was passed\n")
+		slog.Error("no request was passed")
 
 		return
 	}
 
 	if w == nil {
-		log.Printf("error: no response writer was passed\n")
+		slog.Error("no response writer was passed")
 
 		return
 	}
@@ -52,14 +119,16 @@ func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if err := h.DoServeHTTP(ctx, w, *r); err != nil {
-		log.Printf("error: %s\n", err)
+		slog.Error("cannot proxy request", "error", err, "path", r.URL.Path)
+
+		WriteError(w, err)
 	}
 }
 
 // DoServeHTTP does the actual job of ServeHTTP, but it returns an error
 //
 // This method is useful when you want to integrate the handler with a different http server, and it helps
-// to avoid the log.Printf in ServeHTTP, leaving the responsibility of the error handling to the caller.
+// to avoid the logging in ServeHTTP, leaving the responsibility of the error handling to the caller.
 func (h *HTTP) DoServeHTTP(ctx context.Context, w http.ResponseWriter, r http.Request) error {
 	if ctx == nil {
 		return ErrContextIsNil
@@ -69,56 +138,247 @@ func (h *HTTP) DoServeHTTP(ctx context.Context, w http.ResponseWriter, r http.Re
 		return ErrResponseWriterIsNil
 	}
 
+	transforms, err := h.transformsFor(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotApplyResponseTransformers, err)
+	}
+
+	contentType := h.contentType(transforms)
+
+	if IsWatchRequest(r) && contentType != "" {
+		return fmt.Errorf("%w: %w", ErrCannotApplyResponseTransformers, ErrNonJSONWatchTransform)
+	}
+
+	if IsWatchRequest(r) && h.listsOnly(transforms) {
+		return fmt.Errorf("%w: %w", ErrCannotApplyResponseTransformers, ErrListWatchTransform)
+	}
+
+	if h.cache != nil {
+		if body, ok := h.cache.Lookup(&r); ok {
+			// The cached objects come from the apiserver, which therefore answered the request too.
+			metrics.MarkAnswered(ctx, http.StatusOK)
+
+			return h.serveCached(w, r, transforms, contentType, body)
+		}
+	}
+
 	req, err := h.restClientFactory.Request(r)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrCannotCreateRESTClient, err)
 	}
 
+	// The transformers work on json, so the accept header of the client, e.g. asking for protobuf, is overridden:
+	// watch streams in other encodings would otherwise fail to decode after the response has started.
+	if len(transforms) > 0 {
+		req.SetHeader("Accept", ContentTypeJSON)
+	}
+
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	var upstreamHeader http.Header
+
+	cctx = kube.WithResponseObserver(cctx, func(res *http.Response) {
+		upstreamHeader = res.Header.Clone()
+	})
+
+	m := metrics.RecorderFrom(ctx)
+	ri := kube.RequestInfoFor(&r)
+	start := time.Now()
+
+	cctx, span := h.startUpstreamSpan(cctx, req, r)
+
+	if IsWatchRequest(r) {
+		stream, err := req.Stream(cctx)
+
+		// Only the time taken to open the stream is measured, as watches last as long as clients want.
+		m.ObserveUpstream(ri.Verb, ri.APIGroup, ri.Resource, streamStatusCode(err), time.Since(start))
+		metrics.MarkAnswered(ctx, streamStatusCode(err))
+		endUpstreamSpan(span, streamStatusCode(err), err)
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrCannotOpenWatchStream, err)
+		}
+
+		h.responseHeaders.Apply(w.Header(), upstreamHeader)
+
+		return h.serveWatch(cctx, w, r, transforms, stream)
+	}
+
 	res := req.Do(cctx)
 
+	sc := 0
+	res.StatusCode(&sc)
+
+	m.ObserveUpstream(ri.Verb, ri.APIGroup, ri.Resource, sc, time.Since(start))
+	metrics.MarkAnswered(ctx, sc)
+	endUpstreamSpan(span, sc, res.Error())
+
 	body, err := res.Raw()
 	if err != nil {
+		// The apiserver did answer, but with a non-2xx status code: its response is passed through untouched,
+		// so that clients get the original status code and metav1.Status body.
+		if sc != 0 {
+			return h.writeResponse(w, res, upstreamHeader, sc, "", body)
+		}
+
 		return fmt.Errorf("%w: %w", ErrCannotGetProxiedResponseBody, err)
 	}
 
-	body, err = h.applyTransformers(r, body)
+	body, err = h.applyTransformers(r, transforms, body)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrCannotApplyResponseTransformers, err)
 	}
 
-	sc := 0
-	res.StatusCode(&sc)
-	w.WriteHeader(sc)
+	return h.writeResponse(w, res, upstreamHeader, sc, contentType, body)
+}
 
-	_, err = w.Write(body)
+func (h *HTTP) serveCached(
+	w http.ResponseWriter,
+	r http.Request,
+	transforms []Transform,
+	contentType string,
+	body []byte,
+) error {
+	body, err := h.applyTransformers(r, transforms, body)
 	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotApplyResponseTransformers, err)
+	}
+
+	h.responseHeaders.Apply(w.Header(), nil)
+
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	if h.responseHeaders.Allows("Content-Type") {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(body); err != nil {
 		return fmt.Errorf("%w: %w", ErrCannotWriteResponseBody, err)
 	}
 
 	return nil
 }
 
-func (h *HTTP) applyTransformers(r http.Request, body []byte) ([]byte, error) {
-	u, err := url.Parse(r.URL.String())
-	if err != nil {
-		return body, fmt.Errorf("%w: %w", ErrCannotParseRequestURI, err)
+func (h *HTTP) writeResponse(
+	w http.ResponseWriter,
+	res rest.Result,
+	upstreamHeader http.Header,
+	statusCode int,
+	contentType string,
+	body []byte,
+) error {
+	h.writeHeaders(w, res, upstreamHeader)
+
+	if contentType != "" && h.responseHeaders.Allows("Content-Type") {
+		w.Header().Set("Content-Type", contentType)
 	}
 
-	for _, rt := range h.responseTransformers {
-		src := u.Query().Get(rt.Name())
+	w.WriteHeader(statusCode)
 
-		if src != "" {
-			body, err = rt.Run(body, map[string]any{"src": src})
-			if err != nil {
-				return body, fmt.Errorf("%w: %w", ErrCannotTransformResponseBody, err)
-			}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotWriteResponseBody, err)
+	}
+
+	return nil
+}
 
-			return body, nil
+// writeHeaders copies the headers of the upstream response allowed by the policy, falling back to
+// the content type detected by the rest client when the upstream headers could not be observed.
+func (h *HTTP) writeHeaders(w http.ResponseWriter, res rest.Result, upstreamHeader http.Header) {
+	h.responseHeaders.Apply(w.Header(), upstreamHeader)
+
+	if w.Header().Get("Content-Type") != "" || !h.responseHeaders.Allows("Content-Type") {
+		return
+	}
+
+	ct := ""
+	res.ContentType(&ct)
+
+	if ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+}
+
+// applyTransformers runs the pipeline of transformations, feeding each one with the output of the previous one.
+// Errors tell which stage failed, counting from 1.
+func (h *HTTP) applyTransformers(r http.Request, transforms []Transform, body []byte) ([]byte, error) {
+	for i, t := range transforms {
+		rt, err := h.transformer(t.Transformer)
+		if err != nil {
+			return body, fmt.Errorf("stage %d: %w", i+1, err)
+		}
+
+		start := time.Now()
+		_, span := h.tracer.Start(r.Context(), "transformer."+rt.Name())
+
+		body, err = rt.Run(body, t.options())
+
+		metrics.RecorderFrom(r.Context()).ObserveTransformer(rt.Name(), time.Since(start), err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+
+		if err != nil {
+			return body, fmt.Errorf("%w: stage %d (%s): %w", ErrCannotTransformResponseBody, i+1, rt.Name(), err)
 		}
 	}
 
 	return body, nil
 }
+
+// startUpstreamSpan starts the span of the apiserver call, and propagates its trace context to the apiserver.
+func (h *HTTP) startUpstreamSpan(ctx context.Context, req *rest.Request, r http.Request) (context.Context, trace.Span) {
+	ctx, span := h.tracer.Start(
+		ctx,
+		"apiserver "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethod(r.Method),
+			semconv.HTTPTarget(r.URL.Path),
+		),
+	)
+
+	carrier := propagation.HeaderCarrier{}
+	tracing.Propagator.Inject(ctx, carrier)
+
+	for name, values := range carrier {
+		req.SetHeader(name, values...)
+	}
+
+	return ctx, span
+}
+
+func endUpstreamSpan(span trace.Span, statusCode int, err error) {
+	if statusCode != 0 {
+		span.SetAttributes(semconv.HTTPStatusCode(statusCode))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func streamStatusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		return int(apiStatus.Status().Code)
+	}
+
+	return 0
+}
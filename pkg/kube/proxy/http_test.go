@@ -18,6 +18,8 @@ import (
 	utiltesting "k8s.io/client-go/util/testing"
 	"k8s.io/kubectl/pkg/scheme"
 
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	httpx "github.com/omissis/kube-apiserver-proxy/pkg/http"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
 )
@@ -68,6 +70,135 @@ func TestHTTP_DoServeHTTP(t *testing.T) {
 	}
 }
 
+func TestHTTP_DoServeHTTP_ErrorPassthrough(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	status := `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure",` +
+		`"message":"pods \"foo\" not found","reason":"NotFound","details":{"name":"foo","kind":"pods"},"code":404}`
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+
+		_, _ = w.Write([]byte(status))
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{
+			proxy.NewJqResponseBodyTransformer(),
+		},
+	)
+
+	r, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.test/api/v1/namespaces/default/pods/foo?jq=.kind", nil)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	if err := hp.DoServeHTTP(r.Context(), w, *r); err != nil {
+		t.Errorf("did not expect an error, %v given", err)
+	}
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if got := w.Body.String(); got != status {
+		t.Errorf("got = %s, want %s", got, status)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected content type application/json, got %s", got)
+	}
+}
+
+func TestHTTP_DoServeHTTP_ResponseHeaders(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Audit-Id", "1234")
+		w.Header().Set("Cache-Control", "no-cache, private")
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusOK)
+
+		_, _ = w.Write([]byte(`{"kind":"PodList","items":[]}`))
+	}))
+	defer testServer.Close()
+
+	c, err := rest.RESTClientFor(&rest.Config{
+		Host: testServer.URL,
+		ContentConfig: rest.ContentConfig{
+			GroupVersion:         &v1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+		WrapTransport: kube.ObserveResponses,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{},
+		proxy.WithResponseHeaderPolicy(httpx.NewResponseHeaderPolicy(config.HeaderPolicy{
+			Deny: []string{"Cache-Control"},
+			Add:  map[string]string{"X-Served-By": "kube-apiserver-proxy"},
+		})),
+	)
+
+	r, err := http.NewRequest("GET", "https://api.kube-apiserver-proxy.test/api/v1/pods", nil)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	if err := hp.DoServeHTTP(r.Context(), w, *r); err != nil {
+		t.Errorf("did not expect an error, %v given", err)
+	}
+
+	want := map[string]string{
+		"Content-Type":  "application/json",
+		"Audit-Id":      "1234",
+		"Cache-Control": "",
+		"X-Internal":    "",
+		"X-Served-By":   "kube-apiserver-proxy",
+	}
+
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("header %s = %q, want %q", k, got, v)
+		}
+	}
+}
+
 func testServerEnv(t *testing.T, statusCode int) (*httptest.Server, *utiltesting.FakeHandler, *corev1.PodList) {
 	podList := &corev1.PodList{
 		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
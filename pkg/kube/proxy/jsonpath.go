@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	// JSONPathOutputParam is the query parameter selecting the output of the jsonpath transformer.
+	JSONPathOutputParam = "jsonpathOutput"
+
+	JSONPathOutputJSON = "json"
+	JSONPathOutputText = "text"
+)
+
+var ErrUnknownJSONPathOutput = errors.New("unknown jsonpath output, expected json or text")
+
+func NewJSONPathResponseBodyTransformer() *JSONPathResponseBodyTransformer {
+	return &JSONPathResponseBodyTransformer{}
+}
+
+// JSONPathResponseBodyTransformer renders the response with a JSONPath template, as `kubectl -o jsonpath` does,
+// `range` and `end` included. The "output" option selects between the text rendered by kubectl, and json,
+// where the results of each expression are rendered as a json array.
+type JSONPathResponseBodyTransformer struct{}
+
+func (jp *JSONPathResponseBodyTransformer) Name() string {
+	return "jsonpath"
+}
+
+func (jp *JSONPathResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]byte, error) {
+	output, err := jsonPathOutput(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	src, _ := opts["src"].(string)
+
+	// Missing keys render as empty values, matching the default of kubectl.
+	j := jsonpath.New(jp.Name()).AllowMissingKeys(true)
+	j.EnableJSONOutput(output == JSONPathOutputJSON)
+
+	if err := j.Parse(src); err != nil {
+		return nil, err
+	}
+
+	// The integers are decoded as int64, as kubectl does, so that they are not printed in exponent form.
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	if err := j.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	if output == JSONPathOutputText {
+		return buf.Bytes(), nil
+	}
+
+	// The json output is indented, it is compacted to match the output of the other transformers.
+	out := bytes.Buffer{}
+	if err := json.Compact(&out, buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func (jp *JSONPathResponseBodyTransformer) QueryOptions(q url.Values) map[string]any {
+	return map[string]any{"output": q.Get(JSONPathOutputParam)}
+}
+
+func (jp *JSONPathResponseBodyTransformer) ContentType(opts map[string]any) string {
+	if output, err := jsonPathOutput(opts); err == nil && output == JSONPathOutputText {
+		return ContentTypeText
+	}
+
+	return ContentTypeJSON
+}
+
+func jsonPathOutput(opts map[string]any) (string, error) {
+	output, _ := opts["output"].(string)
+
+	switch output {
+	case "", JSONPathOutputJSON:
+		return JSONPathOutputJSON, nil
+
+	case JSONPathOutputText:
+		return JSONPathOutputText, nil
+
+	default:
+		return "", fmt.Errorf("%w: '%s'", ErrUnknownJSONPathOutput, output)
+	}
+}
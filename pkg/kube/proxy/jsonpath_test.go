@@ -0,0 +1,124 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestJSONPathResponseBodyTransformer_Run(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewJSONPathResponseBodyTransformer()
+
+	body := []byte(`{"kind":"PodList","items":[` +
+		`{"metadata":{"name":"web-0","generation":1234567},"spec":{"securityContext":{"runAsUser":1000680000}},` +
+		`"status":{"phase":"Running"}},` +
+		`{"metadata":{"name":"web-1"},"status":{"phase":"Pending","ratio":0.5}}]}`)
+
+	testCases := []struct {
+		desc    string
+		src     string
+		output  string
+		want    string
+		wantErr error
+	}{
+		{
+			desc: "json output",
+			src:  "{.items[*].metadata.name}",
+			want: `["web-0","web-1"]`,
+		},
+		{
+			desc:   "text output",
+			src:    "{.items[*].metadata.name}",
+			output: proxy.JSONPathOutputText,
+			want:   "web-0 web-1",
+		},
+		{
+			desc:   "range",
+			src:    `{range .items[*]}{.metadata.name}{"\t"}{.status.phase}{"\n"}{end}`,
+			output: proxy.JSONPathOutputText,
+			want:   "web-0\tRunning\nweb-1\tPending\n",
+		},
+		{
+			desc:   "filter",
+			src:    `{.items[?(@.status.phase=="Pending")].metadata.name}`,
+			output: proxy.JSONPathOutputText,
+			want:   "web-1",
+		},
+		{
+			desc:   "large integers",
+			src:    `{.items[0].spec.securityContext.runAsUser} {.items[0].metadata.generation}`,
+			output: proxy.JSONPathOutputText,
+			want:   "1000680000 1234567",
+		},
+		{
+			desc:   "floats",
+			src:    `{.items[1].status.ratio}`,
+			output: proxy.JSONPathOutputText,
+			want:   "0.5",
+		},
+		{
+			desc: "large integers in json output",
+			src:  `{.items[0].spec.securityContext.runAsUser}`,
+			want: `[1000680000]`,
+		},
+		{
+			desc:   "missing key",
+			src:    "{.metadata.name}",
+			output: proxy.JSONPathOutputText,
+			want:   "",
+		},
+		{
+			desc:    "unknown output",
+			src:     "{.kind}",
+			output:  "yaml",
+			wantErr: proxy.ErrUnknownJSONPathOutput,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := tf.Run(body, map[string]any{"src": tC.src, "output": tC.output})
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if string(res) != tC.want {
+				t.Errorf("wanted %q, got %q", tC.want, res)
+			}
+		})
+	}
+}
+
+func TestJSONPathResponseBodyTransformer_InvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewJSONPathResponseBodyTransformer()
+
+	if _, err := tf.Run([]byte(`{}`), map[string]any{"src": "{.items["}); err == nil {
+		t.Error("expected an error, got none")
+	}
+}
+
+func TestJSONPathResponseBodyTransformer_ContentType(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewJSONPathResponseBodyTransformer()
+
+	if got := tf.ContentType(tf.QueryOptions(url.Values{})); got != proxy.ContentTypeJSON {
+		t.Errorf("expected %q, got %q", proxy.ContentTypeJSON, got)
+	}
+
+	opts := tf.QueryOptions(url.Values{proxy.JSONPathOutputParam: []string{proxy.JSONPathOutputText}})
+	if got := tf.ContentType(opts); got != proxy.ContentTypeText {
+		t.Errorf("expected %q, got %q", proxy.ContentTypeText, got)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/mock/gomock"
+	rest "k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+)
+
+func TestHTTP_DoServeHTTP_Metrics(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer, _, _ := testServerEnv(t, 200)
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil).
+		Times(2)
+
+	hp := proxy.NewHTTP(cliFacMock, []proxy.ResponseBodyTransformer{proxy.NewJqResponseBodyTransformer()})
+
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	for _, url := range []string{
+		"https://api.kube-apiserver-proxy.test/api/v1/pods?jq=.kind",
+		"https://api.kube-apiserver-proxy.test/api/v1/pods?jq=.[",
+	} {
+		r, err := http.NewRequestWithContext(
+			metrics.WithRecorder(context.Background(), m),
+			http.MethodGet,
+			url,
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("cannot create http request: %v", err)
+		}
+
+		_ = hp.DoServeHTTP(r.Context(), httptest.NewRecorder(), *r)
+	}
+
+	if got := testutil.CollectAndCount(reg, "kube_apiserver_proxy_upstream_request_duration_seconds"); got != 1 {
+		t.Errorf("expected 1 upstream latency series, got %d", got)
+	}
+
+	if got := testutil.CollectAndCount(reg, "kube_apiserver_proxy_transformer_duration_seconds"); got != 1 {
+		t.Errorf("expected 1 transformer latency series, got %d", got)
+	}
+
+	if got := testutil.CollectAndCount(reg, "kube_apiserver_proxy_transformer_errors_total"); got != 1 {
+		t.Errorf("expected 1 transformer error series, got %d", got)
+	}
+}
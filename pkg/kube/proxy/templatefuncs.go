@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// MaxTemplateCount bounds the counts taken by the repeat, indent and nindent helpers.
+const MaxTemplateCount = 1024
+
+var (
+	ErrNotANumber              = errors.New("not a number")
+	ErrTemplateCountOutOfRange = errors.New("template count is out of range")
+)
+
+// templateFuncs returns the helpers available to the go templates. They follow the names and the argument order
+// of sprig, the piped value coming last, but only the side effect free ones are provided: sprig's env and
+// expandenv would expose the environment of the proxy to the clients. The helpers that can produce strings
+// larger than their arguments fail when the result would exceed maxSize bytes.
+func templateFuncs(maxSize int) template.FuncMap {
+	sl := sizeLimiter(maxSize)
+
+	return template.FuncMap{
+		// strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"replace":    sl.replace,
+		"repeat":     sl.repeat,
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"quote":      func(v any) string { return strconv.Quote(toString(v)) },
+		"squote":     func(v any) string { return "'" + toString(v) + "'" },
+		"indent":     sl.indent,
+		"nindent":    sl.nindent,
+		"toString":   toString,
+
+		// defaults
+		"default":  func(def, v any) any { return ternary(empty(v), def, v) },
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary":  func(a, b any, cond bool) any { return ternary(cond, a, b) },
+
+		// collections
+		"first":  first,
+		"last":   last,
+		"keys":   keys,
+		"hasKey": hasKey,
+
+		// numbers
+		"add": func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x + y }) },
+		"sub": func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x - y }) },
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+	}
+}
+
+func toString(v any) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+
+	case string:
+		return vv
+
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func join(sep string, v any) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return toString(v)
+	}
+
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		parts = append(parts, toString(rv.Index(i).Interface()))
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// sizeLimiter computes the size of the results of the helpers before building them, failing when it
+// exceeds the limit.
+type sizeLimiter int
+
+func (sl sizeLimiter) check(size int) error {
+	if size > int(sl) {
+		return fmt.Errorf("%w: more than %d bytes", ErrGoTemplateOutputTooLarge, int(sl))
+	}
+
+	return nil
+}
+
+func (sl sizeLimiter) replace(old, replacement, s string) (string, error) {
+	n := strings.Count(s, old)
+	if len(old) == 0 {
+		n = utf8.RuneCountInString(s) + 1
+	}
+
+	if err := sl.check(len(s) + n*(len(replacement)-len(old))); err != nil {
+		return "", err
+	}
+
+	return strings.ReplaceAll(s, old, replacement), nil
+}
+
+func (sl sizeLimiter) repeat(count int, s string) (string, error) {
+	if err := checkCount(count); err != nil {
+		return "", err
+	}
+
+	if err := sl.check(count * len(s)); err != nil {
+		return "", err
+	}
+
+	return strings.Repeat(s, count), nil
+}
+
+func (sl sizeLimiter) indent(spaces int, s string) (string, error) {
+	if err := checkCount(spaces); err != nil {
+		return "", err
+	}
+
+	if err := sl.check(len(s) + (strings.Count(s, "\n")+1)*spaces); err != nil {
+		return "", err
+	}
+
+	pad := strings.Repeat(" ", spaces)
+
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad), nil
+}
+
+func (sl sizeLimiter) nindent(spaces int, s string) (string, error) {
+	s, err := sl.indent(spaces, s)
+	if err != nil {
+		return "", err
+	}
+
+	return "\n" + s, nil
+}
+
+func checkCount(count int) error {
+	if count < 0 || count > MaxTemplateCount {
+		return fmt.Errorf("%w: %d, expected between 0 and %d", ErrTemplateCountOutOfRange, count, MaxTemplateCount)
+	}
+
+	return nil
+}
+
+func ternary(cond bool, a, b any) any {
+	if cond {
+		return a
+	}
+
+	return b
+}
+
+// empty tells whether the value is the zero value of its type, or an empty collection.
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+
+	default:
+		return rv.IsZero()
+	}
+}
+
+func coalesce(vv ...any) any {
+	for _, v := range vv {
+		if !empty(v) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func first(v any) any {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() == 0 {
+		return nil
+	}
+
+	return rv.Index(0).Interface()
+}
+
+func last(v any) any {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() == 0 {
+		return nil
+	}
+
+	return rv.Index(rv.Len() - 1).Interface()
+}
+
+func keys(m map[string]any) []string {
+	kk := make([]string, 0, len(m))
+	for k := range m {
+		kk = append(kk, k)
+	}
+
+	sort.Strings(kk)
+
+	return kk
+}
+
+func hasKey(m map[string]any, key string) bool {
+	_, ok := m[key]
+
+	return ok
+}
+
+func arith(a, b any, op func(x, y int64) int64) (int64, error) {
+	x, err := toInt64(a)
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := toInt64(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return op(x, y), nil
+}
+
+func toInt64(v any) (int64, error) {
+	switch vv := v.(type) {
+	case int:
+		return int64(vv), nil
+
+	case int64:
+		return vv, nil
+
+	case float64:
+		return int64(vv), nil
+
+	case string:
+		i, err := strconv.ParseInt(vv, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrNotANumber, vv)
+		}
+
+		return i, nil
+
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrNotANumber, v)
+	}
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+
+	return string(b), err
+}
+
+func toPrettyJSON(v any) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	return string(b), err
+}
@@ -0,0 +1,95 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+	rest "k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestHTTP_DoServeHTTP_Tracing(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	traceparents := make(chan string, 1)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("Traceparent")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"PodList","apiVersion":"v1","items":[]}`))
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{proxy.NewJqResponseBodyTransformer()},
+		proxy.WithTracerProvider(tp),
+	)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.kube-apiserver-proxy.test/api/v1/pods?jq=.kind", nil)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	if err := hp.DoServeHTTP(ctx, httptest.NewRecorder(), *r); err != nil {
+		t.Fatalf("did not expect an error, %v given", err)
+	}
+
+	parent.End()
+
+	spans := exporter.GetSpans()
+
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+
+	upstream, ok := byName["apiserver GET"]
+	if !ok {
+		t.Fatalf("expected an apiserver span, got %v", spans)
+	}
+
+	if upstream.SpanKind != trace.SpanKindClient || upstream.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected a client span child of the request one, got %s", upstream.SpanKind)
+	}
+
+	want := "00-" + upstream.SpanContext.TraceID().String() + "-" + upstream.SpanContext.SpanID().String() + "-01"
+
+	if got := <-traceparents; got != want {
+		t.Errorf("expected traceparent %s to be sent to the apiserver, got %s", want, got)
+	}
+
+	if _, ok := byName["transformer.jq"]; !ok {
+		t.Errorf("expected a transformer span, got %v", spans)
+	}
+}
@@ -1,20 +1,72 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/itchyny/gojq"
 )
 
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeText   = "text/plain; charset=utf-8"
+
+	// JqOutputParam is the query parameter selecting the output of the jq transformer.
+	JqOutputParam = "jqOutput"
+	// JqArgParamPrefix prefixes the query parameters binding the variables of the jq programs, e.g. `jqArg.ns`.
+	JqArgParamPrefix = "jqArg."
+
+	JqOutputJSON   = "json"
+	JqOutputArray  = "array"
+	JqOutputNDJSON = "ndjson"
+	JqOutputRaw    = "raw"
+)
+
+var (
+	ErrInvalidJqVariable = errors.New("invalid jq variable name")
+	ErrMultipleJqResults = errors.New("jq program returned several results, use the array or ndjson output")
+	ErrUnknownJqOutput   = errors.New("unknown jq output, expected json, array, ndjson or raw")
+
+	jqVariableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
 type ResponseBodyTransformer interface {
 	Name() string
 	Run([]byte, map[string]any) ([]byte, error)
 }
 
+// QueryOptionsTransformer is implemented by the transformers that take options from the query string,
+// on top of their program. They also complete the options of the named transforms, without overriding them.
+type QueryOptionsTransformer interface {
+	QueryOptions(q url.Values) map[string]any
+}
+
+// ListTransformer is implemented by the transformers that only apply to list responses, which therefore
+// cannot transform the objects of the watch events.
+type ListTransformer interface {
+	ListsOnly() bool
+}
+
+// ContentTypeTransformer is implemented by the transformers whose output is not always json.
+type ContentTypeTransformer interface {
+	ContentType(opts map[string]any) string
+}
+
 func NewJqResponseBodyTransformer() *JqResponseBodyTransformer {
 	return &JqResponseBodyTransformer{}
 }
 
+// JqResponseBodyTransformer runs a jq program against the response, which can be any json value. The "output"
+// option tells how the results are written: as a single json value, as a json array, as newline delimited json,
+// or as raw strings like `jq -r` does. The "args" option binds string values to the $variables of the program,
+// like `jq --arg` does, so that clients can parameterize the queries without building them.
 type JqResponseBodyTransformer struct{}
 
 func (jq *JqResponseBodyTransformer) Name() string {
@@ -22,19 +74,36 @@ func (jq *JqResponseBodyTransformer) Name() string {
 }
 
 func (jq *JqResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]byte, error) {
-	query, err := gojq.Parse(opts["src"].(string))
+	output, err := jqOutput(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	src, _ := opts["src"].(string)
+
+	query, err := gojq.Parse(src)
 	if err != nil {
 		return nil, err
 	}
 
-	data := map[string]any{}
+	names, values, err := jqVariables(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := gojq.Compile(query, gojq.WithVariables(names))
+	if err != nil {
+		return nil, err
+	}
+
+	var data any
 	if err = json.Unmarshal(body, &data); err != nil {
 		return nil, err
 	}
 
-	vvv := make([]byte, 0)
+	results := make([]any, 0)
 
-	iter := query.Run(data)
+	iter := code.Run(data, values...)
 
 	for {
 		v, ok := iter.Next()
@@ -46,13 +115,118 @@ func (jq *JqResponseBodyTransformer) Run(body []byte, opts map[string]any) ([]by
 			return nil, err
 		}
 
-		vv, err := json.Marshal(v)
-		if err != nil {
-			return nil, err
+		results = append(results, v)
+	}
+
+	return writeJqResults(output, results)
+}
+
+func (jq *JqResponseBodyTransformer) QueryOptions(q url.Values) map[string]any {
+	args := make(map[string]string)
+
+	for k, vv := range q {
+		if name, ok := strings.CutPrefix(k, JqArgParamPrefix); ok && len(vv) > 0 {
+			args[name] = vv[0]
+		}
+	}
+
+	return map[string]any{"output": q.Get(JqOutputParam), "args": args}
+}
+
+func (jq *JqResponseBodyTransformer) ContentType(opts map[string]any) string {
+	output, err := jqOutput(opts)
+	if err != nil {
+		return ContentTypeJSON
+	}
+
+	switch output {
+	case JqOutputNDJSON:
+		return ContentTypeNDJSON
+
+	case JqOutputRaw:
+		return ContentTypeText
+
+	default:
+		return ContentTypeJSON
+	}
+}
+
+func jqOutput(opts map[string]any) (string, error) {
+	output, _ := opts["output"].(string)
+
+	switch output {
+	case "":
+		return JqOutputJSON, nil
+
+	case JqOutputJSON, JqOutputArray, JqOutputNDJSON, JqOutputRaw:
+		return output, nil
+
+	default:
+		return "", fmt.Errorf("%w: '%s'", ErrUnknownJqOutput, output)
+	}
+}
+
+// jqVariables returns the names of the variables of the program, sorted, along with their values.
+func jqVariables(opts map[string]any) ([]string, []any, error) {
+	args, _ := opts["args"].(map[string]string)
+
+	names := make([]string, 0, len(args))
+
+	for name := range args {
+		if !jqVariableName.MatchString(name) {
+			return nil, nil, fmt.Errorf("%w: '%s'", ErrInvalidJqVariable, name)
 		}
 
-		vvv = append(vvv, vv...)
+		names = append(names, name)
 	}
 
-	return vvv, nil
+	sort.Strings(names)
+
+	values := make([]any, 0, len(names))
+
+	for i, name := range names {
+		values = append(values, args[name])
+		names[i] = "$" + name
+	}
+
+	return names, values, nil
+}
+
+func writeJqResults(output string, results []any) ([]byte, error) {
+	switch output {
+	case JqOutputArray:
+		return json.Marshal(results)
+
+	case JqOutputNDJSON, JqOutputRaw:
+		buf := bytes.Buffer{}
+
+		for _, v := range results {
+			if s, ok := v.(string); ok && output == JqOutputRaw {
+				buf.WriteString(s)
+			} else {
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+
+				buf.Write(b)
+			}
+
+			buf.WriteByte('\n')
+		}
+
+		return buf.Bytes(), nil
+
+	default:
+		switch len(results) {
+		case 0:
+			return []byte("null"), nil
+
+		case 1:
+			return json.Marshal(results[0])
+
+		default:
+			return nil, fmt.Errorf("%w: got %d", ErrMultipleJqResults, len(results))
+		}
+	}
 }
@@ -3,6 +3,8 @@
 package proxy_test
 
 import (
+	"errors"
+	"net/url"
 	"testing"
 
 	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
@@ -67,3 +69,135 @@ func TestJqResponseBodyTransformer_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestJqResponseBodyTransformer_Outputs(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewJqResponseBodyTransformer()
+
+	body := []byte(`{"items":[{"metadata":{"name":"web-0","namespace":"default"}},` +
+		`{"metadata":{"name":"db-0","namespace":"data"}}]}`)
+
+	testCases := []struct {
+		desc    string
+		body    []byte
+		src     string
+		output  string
+		args    map[string]string
+		want    string
+		wantErr error
+	}{
+		{
+			desc: "array input",
+			body: []byte(`[1,2,3]`),
+			src:  "map(. * 2)",
+			want: `[2,4,6]`,
+		},
+		{
+			desc: "scalar input",
+			body: []byte(`"web"`),
+			src:  `. + "-0"`,
+			want: `"web-0"`,
+		},
+		{
+			desc:    "several results",
+			body:    body,
+			src:     ".items[].metadata.name",
+			wantErr: proxy.ErrMultipleJqResults,
+		},
+		{
+			desc: "no result",
+			body: body,
+			src:  "empty",
+			want: `null`,
+		},
+		{
+			desc:   "array output",
+			body:   body,
+			src:    ".items[].metadata.name",
+			output: proxy.JqOutputArray,
+			want:   `["web-0","db-0"]`,
+		},
+		{
+			desc:   "ndjson output",
+			body:   body,
+			src:    ".items[].metadata",
+			output: proxy.JqOutputNDJSON,
+			want:   "{\"name\":\"web-0\",\"namespace\":\"default\"}\n{\"name\":\"db-0\",\"namespace\":\"data\"}\n",
+		},
+		{
+			desc:   "raw output",
+			body:   body,
+			src:    ".items[].metadata.name, (.items | length)",
+			output: proxy.JqOutputRaw,
+			want:   "web-0\ndb-0\n2\n",
+		},
+		{
+			desc:    "unknown output",
+			body:    body,
+			src:     ".",
+			output:  "yaml",
+			wantErr: proxy.ErrUnknownJqOutput,
+		},
+		{
+			desc:   "variables",
+			body:   body,
+			src:    `[.items[] | select(.metadata.namespace == $ns) | .metadata.name | $prefix + .]`,
+			args:   map[string]string{"ns": "data", "prefix": "pod/"},
+			want:   `["pod/db-0"]`,
+			output: proxy.JqOutputJSON,
+		},
+		{
+			desc:    "invalid variable name",
+			body:    body,
+			src:     ".",
+			args:    map[string]string{"ns-1": "data"},
+			wantErr: proxy.ErrInvalidJqVariable,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := tf.Run(tC.body, map[string]any{"src": tC.src, "output": tC.output, "args": tC.args})
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if string(res) != tC.want {
+				t.Errorf("wanted %q, got %q", tC.want, res)
+			}
+		})
+	}
+}
+
+func TestJqResponseBodyTransformer_QueryOptions(t *testing.T) {
+	t.Parallel()
+
+	tf := proxy.NewJqResponseBodyTransformer()
+
+	q := url.Values{
+		proxy.JqOutputParam:            []string{proxy.JqOutputRaw},
+		proxy.JqArgParamPrefix + "ns":  []string{"default"},
+		proxy.JqArgParamPrefix + "app": []string{"web"},
+		"labelSelector":                []string{"app=web"},
+	}
+
+	opts := tf.QueryOptions(q)
+	opts["src"] = "$ns + \"/\" + $app"
+
+	res, err := tf.Run([]byte(`{}`), opts)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %v", err)
+	}
+
+	if got, want := string(res), "default/web\n"; got != want {
+		t.Errorf("wanted %q, got %q", want, got)
+	}
+
+	if got := tf.ContentType(opts); got != proxy.ContentTypeText {
+		t.Errorf("expected content type %q, got %q", proxy.ContentTypeText, got)
+	}
+}
@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+// TransformParam is the query parameter selecting a named transform.
+const TransformParam = "transform"
+
+var (
+	ErrAdHocTransformsDisabled = errors.New("ad-hoc transformations are disabled, select a named transform instead")
+	ErrAdHocTemplatesDisabled  = errors.New("ad-hoc go templates are disabled, select a named transform instead")
+	ErrListWatchTransform      = errors.New("list transforms cannot be applied to watch events")
+	ErrNonJSONWatchTransform   = errors.New("watch events can only be transformed into json")
+	ErrUnknownTransform        = errors.New("unknown transform")
+	ErrUnknownTransformer      = errors.New("unknown transformer")
+)
+
+// Transform is a transformation of the response body: the name of the transformer to run, its program
+// and the options specific to the transformer, if any.
+type Transform struct {
+	Transformer string
+	Src         string
+	Options     map[string]any
+}
+
+func (t Transform) options() map[string]any {
+	opts := make(map[string]any, len(t.Options)+1)
+
+	for k, v := range t.Options {
+		opts[k] = v
+	}
+
+	opts["src"] = t.Src
+
+	return opts
+}
+
+// WithTransforms makes the named transforms of the config available to the clients, applies them
+// to the requests matching their routes and, if configured so, rejects the ad-hoc transformations.
+func WithTransforms(conf config.Transforms) HTTPOption {
+	return func(h *HTTP) {
+		h.transforms = newTransformCatalog(conf)
+	}
+}
+
+func newTransformCatalog(conf config.Transforms) transformCatalog {
+	tc := transformCatalog{
+		disableAdHoc:        conf.DisableAdHoc,
+		allowAdHocTemplates: conf.AllowAdHocTemplates,
+		named:               make(map[string]Transform, len(conf.Named)),
+		routes:              conf.Routes,
+	}
+
+	for name, t := range conf.Named {
+		tc.named[name] = transformOf(t)
+	}
+
+	return tc
+}
+
+func transformOf(t config.Transform) Transform {
+	switch {
+	case t.JSONPath != "":
+		return Transform{Transformer: "jsonpath", Src: t.JSONPath, Options: map[string]any{"output": t.Output}}
+
+	case t.CEL != "":
+		return Transform{Transformer: "cel", Src: t.CEL}
+
+	case t.CELFilter != "":
+		return Transform{Transformer: "celFilter", Src: t.CELFilter}
+
+	case t.GoTemplate != "":
+		return Transform{Transformer: "gotemplate", Src: t.GoTemplate, Options: map[string]any{"output": t.Output}}
+
+	default:
+		return Transform{Transformer: "jq", Src: t.JQ, Options: map[string]any{"output": t.Output}}
+	}
+}
+
+type transformCatalog struct {
+	disableAdHoc        bool
+	allowAdHocTemplates bool
+	named               map[string]Transform
+	routes              []config.TransformRoute
+}
+
+// transformsFor returns the pipeline of transformations to apply to the response of the request, in the order
+// the client listed them in the query string, e.g. `?transform=podSummary&jq=...`: each one receives the output
+// of the previous one. When the client lists none, the transform of the first matching route applies, if any.
+// The variables given in the query string, e.g. `jqArg.ns`, apply to every stage, while the output options,
+// e.g. `jqOutput`, only apply to the last one, as the others must pass json along.
+func (h *HTTP) transformsFor(r http.Request) ([]Transform, error) {
+	params, err := queryParams(r.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotParseRequestURI, err)
+	}
+
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotParseRequestURI, err)
+	}
+
+	transforms := make([]Transform, 0)
+
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+
+		if p.key == TransformParam {
+			t, ok := h.transforms.named[p.value]
+			if !ok {
+				return nil, fmt.Errorf("%w: '%s'", ErrUnknownTransform, p.value)
+			}
+
+			transforms = append(transforms, t)
+
+			continue
+		}
+
+		rt, err := h.transformer(p.key)
+		if err != nil {
+			continue
+		}
+
+		if h.transforms.disableAdHoc {
+			return nil, ErrAdHocTransformsDisabled
+		}
+
+		if _, ok := rt.(*GoTemplateResponseBodyTransformer); ok && !h.transforms.allowAdHocTemplates {
+			return nil, ErrAdHocTemplatesDisabled
+		}
+
+		transforms = append(transforms, Transform{Transformer: p.key, Src: p.value})
+	}
+
+	if len(transforms) > 0 {
+		for i, t := range transforms {
+			transforms[i] = h.withQueryOptions(t, q, i == len(transforms)-1)
+		}
+
+		return transforms, nil
+	}
+
+	for _, route := range h.transforms.routes {
+		if matchesRoute(route, &r) {
+			return []Transform{h.withQueryOptions(h.transforms.named[route.Transform], q, true)}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// withQueryOptions completes the options of a transform with the ones given in the query string, such as
+// the variables of the jq programs: the options set in the config take precedence. The output option
+// of the query string is only used for the last stage of the pipeline.
+func (h *HTTP) withQueryOptions(t Transform, q url.Values, last bool) Transform {
+	rt, err := h.transformer(t.Transformer)
+	if err != nil {
+		return t
+	}
+
+	qot, ok := rt.(QueryOptionsTransformer)
+	if !ok {
+		return t
+	}
+
+	opts := qot.QueryOptions(q)
+	if !last {
+		delete(opts, "output")
+	}
+
+	for k, v := range t.Options {
+		if s, ok := v.(string); ok && s == "" {
+			continue
+		}
+
+		opts[k] = v
+	}
+
+	t.Options = opts
+
+	return t
+}
+
+type queryParam struct {
+	key   string
+	value string
+}
+
+// queryParams parses the query string like url.ParseQuery does, but it keeps the order of the parameters.
+func queryParams(rawQuery string) ([]queryParam, error) {
+	params := make([]queryParam, 0)
+
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		k, v, _ := strings.Cut(part, "=")
+
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, queryParam{key: key, value: value})
+	}
+
+	return params, nil
+}
+
+// contentType returns the content type of the output of the last transformation, or an empty string
+// when it is json, or unknown, for the content type of the apiserver response to be kept.
+func (h *HTTP) contentType(transforms []Transform) string {
+	if len(transforms) == 0 {
+		return ""
+	}
+
+	last := transforms[len(transforms)-1]
+
+	rt, err := h.transformer(last.Transformer)
+	if err != nil {
+		return ""
+	}
+
+	ctt, ok := rt.(ContentTypeTransformer)
+	if !ok {
+		return ""
+	}
+
+	if ct := ctt.ContentType(last.Options); ct != ContentTypeJSON {
+		return ct
+	}
+
+	return ""
+}
+
+// listsOnly tells whether any of the transforms only applies to list responses.
+func (h *HTTP) listsOnly(transforms []Transform) bool {
+	for _, t := range transforms {
+		rt, err := h.transformer(t.Transformer)
+		if err != nil {
+			continue
+		}
+
+		if lt, ok := rt.(ListTransformer); ok && lt.ListsOnly() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *HTTP) transformer(name string) (ResponseBodyTransformer, error) {
+	for _, rt := range h.responseTransformers {
+		if rt.Name() == name {
+			return rt, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownTransformer, name)
+}
+
+func matchesRoute(route config.TransformRoute, r *http.Request) bool {
+	return kube.RequestInfoFor(r).Matches(route.Verbs, route.APIGroups, route.Resources) &&
+		matchesPath(route.Paths, r.URL.Path)
+}
+
+func matchesPath(patterns []string, urlPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if m, err := path.Match(p, urlPath); err == nil && m {
+			return true
+		}
+	}
+
+	return false
+}
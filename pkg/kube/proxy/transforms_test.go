@@ -0,0 +1,280 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestHTTP_DoServeHTTP_Transforms(t *testing.T) {
+	t.Parallel()
+
+	pods := []byte(`{"kind":"PodList","items":[{"metadata":{"name":"web-0"}},{"metadata":{"name":"web-1"}}]}`)
+	deployments := []byte(`{"kind":"DeploymentList","items":[]}`)
+	status := []byte(`{"kind":"Pod","items":[]}`)
+
+	conf := config.Transforms{
+		Named: map[string]config.Transform{
+			"names": {JQ: "[.items[].metadata.name]"},
+			"count": {JQ: ".items | length"},
+			"index": {JQ: "{names: [.items[].metadata.name]}"},
+			"lines": {JSONPath: `{range .items[*]}{.metadata.name}{"\n"}{end}`, Output: "text"},
+			"named": {JQ: `[.items[].metadata.name | select(. == $name)]`},
+			"table": {GoTemplate: `{{range .items}}{{.metadata.name | upper}};{{end}}`},
+		},
+		Routes: []config.TransformRoute{
+			{Transform: "names", Verbs: []string{"list"}, Resources: []string{"pods"}},
+		},
+	}
+
+	testCases := []struct {
+		desc     string
+		conf     config.Transforms
+		target   string
+		wantBody string
+		wantErr  error
+		wantMsg  string
+		wantType string
+	}{
+		{
+			desc:     "named transform",
+			conf:     conf,
+			target:   "/api/v1/pods?transform=count",
+			wantBody: `2`,
+		},
+		{
+			desc:    "unknown named transform",
+			conf:    conf,
+			target:  "/api/v1/pods?transform=unknown",
+			wantErr: proxy.ErrUnknownTransform,
+		},
+		{
+			desc:     "route transform",
+			conf:     conf,
+			target:   "/api/v1/pods",
+			wantBody: `["web-0","web-1"]`,
+		},
+		{
+			desc:     "ad-hoc transform replaces the route one",
+			conf:     conf,
+			target:   "/api/v1/pods?jq=.kind",
+			wantBody: `"PodList"`,
+		},
+		{
+			desc:     "no matching route",
+			conf:     conf,
+			target:   "/apis/apps/v1/deployments",
+			wantBody: string(deployments),
+		},
+		{
+			desc: "route matching a glob api group",
+			conf: config.Transforms{
+				Named:  conf.Named,
+				Routes: []config.TransformRoute{{Transform: "count", APIGroups: []string{"app*"}}},
+			},
+			target:   "/apis/apps/v1/deployments",
+			wantBody: `0`,
+		},
+		{
+			desc: "route resource without its subresources",
+			conf: config.Transforms{
+				Named:  conf.Named,
+				Routes: []config.TransformRoute{{Transform: "count", Resources: []string{"pods"}}},
+			},
+			target:   "/api/v1/namespaces/default/pods/web-0/status",
+			wantBody: string(status),
+		},
+		{
+			desc: "route matching all the subresources of a resource",
+			conf: config.Transforms{
+				Named:  conf.Named,
+				Routes: []config.TransformRoute{{Transform: "count", Resources: []string{"pods/*"}}},
+			},
+			target:   "/api/v1/namespaces/default/pods/web-0/status",
+			wantBody: `0`,
+		},
+		{
+			desc:     "pipeline of transforms",
+			conf:     conf,
+			target:   "/api/v1/pods?transform=index&jq=.names%20%7C%20length",
+			wantBody: `2`,
+		},
+		{
+			desc:     "pipeline mixing ad-hoc and named transforms",
+			conf:     conf,
+			target:   "/api/v1/pods?jq=%7Bitems%7D&transform=index&jq=.names%5B1%5D",
+			wantBody: `"web-1"`,
+		},
+		{
+			desc:    "failing stage",
+			conf:    conf,
+			target:  "/api/v1/pods?transform=count&jq=.items",
+			wantErr: proxy.ErrCannotTransformResponseBody,
+			wantMsg: "stage 2 (jq)",
+		},
+		{
+			desc:     "named jsonpath transform",
+			conf:     conf,
+			target:   "/api/v1/pods?transform=lines",
+			wantBody: "web-0\nweb-1\n",
+			wantType: proxy.ContentTypeText,
+		},
+		{
+			desc:     "ad-hoc jsonpath transform",
+			conf:     conf,
+			target:   "/api/v1/pods?jsonpath=%7B.items%5B0%5D.metadata.name%7D&jsonpathOutput=text",
+			wantBody: "web-0",
+			wantType: proxy.ContentTypeText,
+		},
+		{
+			desc:     "cel filter",
+			conf:     conf,
+			target:   "/api/v1/pods?celFilter=object.metadata.name%20!=%20'web-0'&transform=index",
+			wantBody: `{"names":["web-1"]}`,
+		},
+		{
+			desc:     "named go template",
+			conf:     conf,
+			target:   "/api/v1/pods?transform=table",
+			wantBody: "WEB-0;WEB-1;",
+			wantType: proxy.ContentTypeText,
+		},
+		{
+			desc:    "ad-hoc go template",
+			conf:    conf,
+			target:  "/api/v1/pods?gotemplate=%7B%7B.kind%7D%7D",
+			wantErr: proxy.ErrAdHocTemplatesDisabled,
+		},
+		{
+			desc: "allowed ad-hoc go template",
+			conf: config.Transforms{
+				AllowAdHocTemplates: true,
+			},
+			target:   "/api/v1/pods?gotemplate=%7B%22kind%22:%22%7B%7B.kind%7D%7D%22%7D&gotemplateOutput=json",
+			wantBody: `{"kind":"PodList"}`,
+		},
+		{
+			desc: "named transform with variables",
+			conf: config.Transforms{
+				DisableAdHoc: true,
+				Named:        conf.Named,
+			},
+			target:   "/api/v1/pods?transform=named&jqArg.name=web-1",
+			wantBody: `["web-1"]`,
+		},
+		{
+			desc:     "ndjson output",
+			conf:     conf,
+			target:   "/api/v1/pods?jq=.items%5B%5D.metadata.name&jqOutput=ndjson",
+			wantBody: "\"web-0\"\n\"web-1\"\n",
+			wantType: proxy.ContentTypeNDJSON,
+		},
+		{
+			desc:     "output of the last stage of a pipeline",
+			conf:     conf,
+			target:   "/api/v1/pods?jq=.items%5B0%5D.metadata.name&jq=ascii_upcase&jqOutput=raw",
+			wantBody: "WEB-0\n",
+			wantType: proxy.ContentTypeText,
+		},
+		{
+			desc:    "text transform of a watch",
+			conf:    conf,
+			target:  "/api/v1/pods?watch=true&transform=lines",
+			wantErr: proxy.ErrNonJSONWatchTransform,
+		},
+		{
+			desc:    "cel filter of a watch",
+			conf:    conf,
+			target:  "/api/v1/pods?watch=true&celFilter=true",
+			wantErr: proxy.ErrListWatchTransform,
+		},
+		{
+			desc: "ad-hoc transforms disabled",
+			conf: config.Transforms{
+				DisableAdHoc: true,
+				Named:        conf.Named,
+			},
+			target:  "/api/v1/pods?jq=.kind",
+			wantErr: proxy.ErrAdHocTransformsDisabled,
+		},
+		{
+			desc: "named transform with ad-hoc transforms disabled",
+			conf: config.Transforms{
+				DisableAdHoc: true,
+				Named:        conf.Named,
+			},
+			target:   "/api/v1/pods?transform=count",
+			wantBody: `2`,
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			hp := proxy.NewHTTP(
+				kube.NewMockRESTClientFactory(ctrl),
+				[]proxy.ResponseBodyTransformer{
+					proxy.NewJqResponseBodyTransformer(),
+					proxy.NewJSONPathResponseBodyTransformer(),
+					proxy.NewCELFilterResponseBodyTransformer(),
+					proxy.NewGoTemplateResponseBodyTransformer(),
+				},
+				proxy.WithReadCache(staticReadCache{
+					"/api/v1/pods":                                 pods,
+					"/apis/apps/v1/deployments":                    deployments,
+					"/api/v1/namespaces/default/pods/web-0/status": status,
+				}),
+				proxy.WithTransforms(tC.conf),
+			)
+
+			r := httptest.NewRequest(http.MethodGet, tC.target, nil)
+			w := httptest.NewRecorder()
+
+			err := hp.DoServeHTTP(r.Context(), w, *r)
+			if tC.wantErr != nil {
+				if !errors.Is(err, tC.wantErr) {
+					t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+				}
+
+				if !strings.Contains(err.Error(), tC.wantMsg) {
+					t.Errorf("expected error to contain %q, got %q", tC.wantMsg, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("did not expect an error, %v given", err)
+			}
+
+			if got := w.Body.String(); got != tC.wantBody {
+				t.Errorf("got = %s, want %s", got, tC.wantBody)
+			}
+
+			wantType := tC.wantType
+			if wantType == "" {
+				wantType = proxy.ContentTypeJSON
+			}
+
+			if got := w.Header().Get("Content-Type"); got != wantType {
+				t.Errorf("expected content type %q, got %q", wantType, got)
+			}
+		})
+	}
+}
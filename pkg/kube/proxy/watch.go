@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+const (
+	// watchEventError carries a metav1.Status, e.g. when the resource version of the watch is too old.
+	watchEventError = "ERROR"
+	// watchEventBookmark carries an object with just its kind and resource version.
+	watchEventBookmark = "BOOKMARK"
+)
+
+var (
+	ErrCannotDecodeWatchEvent   = errors.New("cannot decode watch event")
+	ErrCannotEncodeWatchEvent   = errors.New("cannot encode watch event")
+	ErrCannotFlushWatchEvent    = errors.New("cannot flush watch event")
+	ErrCannotOpenWatchStream    = errors.New("cannot open watch stream")
+	ErrCannotTransformWatchItem = errors.New("cannot transform watch event object")
+)
+
+// watchEvent mirrors the json framing used by the apiserver for watch streams,
+// keeping the object raw so that it can be transformed without decoding it into a go type.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// IsWatchRequest tells whether the request asks the apiserver for a stream of watch events,
+// either via the `watch` query parameter or via the legacy `/watch/` path segment.
+func IsWatchRequest(r http.Request) bool {
+	if r.URL == nil {
+		return false
+	}
+
+	return kube.RequestInfoFor(&r).Verb == kube.VerbWatch
+}
+
+// serveWatch proxies a watch request as a chunked stream, flushing every event as soon as it is received.
+// Response transformers are applied to the object of each event rather than to the stream as a whole,
+// except for the error and bookmark events, which are passed through untouched for the clients to handle them.
+// The stream is closed as soon as the context is canceled, which happens when the client disconnects,
+// or the proxy is drained, in which case the response is ended cleanly.
+func (h *HTTP) serveWatch(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r http.Request,
+	transforms []Transform,
+	stream io.ReadCloser,
+) error {
+	defer stream.Close()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.drain:
+		}
+
+		stream.Close()
+	}()
+
+	rc := http.NewResponseController(w)
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCannotFlushWatchEvent, err)
+	}
+
+	dec := json.NewDecoder(stream)
+	enc := json.NewEncoder(w)
+
+	for {
+		var event watchEvent
+
+		if err := dec.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil || h.draining() {
+				return nil
+			}
+
+			return fmt.Errorf("%w: %w", ErrCannotDecodeWatchEvent, err)
+		}
+
+		if event.Type != watchEventError && event.Type != watchEventBookmark {
+			obj, err := h.applyTransformers(r, transforms, event.Object)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrCannotTransformWatchItem, err)
+			}
+
+			event.Object = obj
+		}
+
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("%w: %w", ErrCannotEncodeWatchEvent, err)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return fmt.Errorf("%w: %w", ErrCannotFlushWatchEvent, err)
+		}
+	}
+}
+
+func (h *HTTP) draining() bool {
+	select {
+	case <-h.drain:
+		return true
+	default:
+		return false
+	}
+}
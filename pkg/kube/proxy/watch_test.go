@@ -0,0 +1,382 @@
+//go:build unit
+
+package proxy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+	rest "k8s.io/client-go/rest"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube/proxy"
+)
+
+func TestIsWatchRequest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc string
+		url  string
+		want bool
+	}{
+		{
+			desc: "list request",
+			url:  "https://api.kube-apiserver-proxy.test/api/v1/pods",
+			want: false,
+		},
+		{
+			desc: "watch query parameter",
+			url:  "https://api.kube-apiserver-proxy.test/api/v1/pods?watch=true",
+			want: true,
+		},
+		{
+			desc: "numeric watch query parameter",
+			url:  "https://api.kube-apiserver-proxy.test/apis/apps/v1/deployments?watch=1",
+			want: true,
+		},
+		{
+			desc: "disabled watch query parameter",
+			url:  "https://api.kube-apiserver-proxy.test/api/v1/pods?watch=false",
+			want: false,
+		},
+		{
+			desc: "legacy core watch path",
+			url:  "https://api.kube-apiserver-proxy.test/api/v1/watch/namespaces/default/pods",
+			want: true,
+		},
+		{
+			desc: "legacy group watch path",
+			url:  "https://api.kube-apiserver-proxy.test/apis/apps/v1/watch/deployments",
+			want: true,
+		},
+		{
+			desc: "resource named watch",
+			url:  "https://api.kube-apiserver-proxy.test/api/v1/namespaces/watch/pods",
+			want: false,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := http.NewRequest(http.MethodGet, tC.url, nil)
+			if err != nil {
+				t.Fatalf("cannot create http request: %v", err)
+			}
+
+			if got := proxy.IsWatchRequest(*r); got != tC.want {
+				t.Errorf("IsWatchRequest() = %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+const (
+	watchBookmark = `{"type":"BOOKMARK","object":{"kind":"Pod","metadata":{"resourceVersion":"42"}}}`
+	watchError    = `{"type":"ERROR","object":{"kind":"Status","status":"Failure","reason":"Expired","code":410}}`
+)
+
+func TestHTTP_DoServeHTTP_Watch(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		for _, name := range []string{"foo", "bar"} {
+			fmt.Fprintf(w, `{"type":"ADDED","object":{"kind":"Pod","metadata":{"name":%q}}}`+"\n", name)
+
+			w.(http.Flusher).Flush()
+		}
+
+		fmt.Fprintln(w, watchBookmark)
+		fmt.Fprintln(w, watchError)
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{
+			proxy.NewJqResponseBodyTransformer(),
+		},
+	)
+
+	r, err := http.NewRequest(
+		http.MethodGet,
+		"https://api.kube-apiserver-proxy.test/api/v1/pods?watch=true&jq=.metadata.name",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	if err := hp.DoServeHTTP(r.Context(), w, *r); err != nil {
+		t.Errorf("did not expect an error, %v given", err)
+	}
+
+	want := `{"type":"ADDED","object":"foo"}` + "\n" + `{"type":"ADDED","object":"bar"}` + "\n" +
+		watchBookmark + "\n" + watchError + "\n"
+
+	if got := w.Body.String(); got != want {
+		t.Errorf("got = %s, want %s", got, want)
+	}
+
+	if !w.Flushed {
+		t.Errorf("expected the response to be flushed")
+	}
+}
+
+func TestHTTP_DoServeHTTP_WatchAcceptJSON(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept"); got != proxy.ContentTypeJSON {
+			t.Errorf("expected the apiserver to be asked for json, got accept header %q", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"kind":"Pod","metadata":{"name":"foo"}}}`)
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The factory copies the headers allowed by the request header policy, the accept one included.
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c).SetHeader("Accept", "application/vnd.kubernetes.protobuf;stream=watch"), nil)
+
+	hp := proxy.NewHTTP(
+		cliFacMock,
+		[]proxy.ResponseBodyTransformer{
+			proxy.NewJqResponseBodyTransformer(),
+		},
+	)
+
+	r, err := http.NewRequest(
+		http.MethodGet,
+		"https://api.kube-apiserver-proxy.test/api/v1/pods?watch=true&jq=.metadata.name",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	r.Header.Set("Accept", "application/vnd.kubernetes.protobuf;stream=watch")
+
+	w := httptest.NewRecorder()
+
+	if err := hp.DoServeHTTP(r.Context(), w, *r); err != nil {
+		t.Errorf("did not expect an error, %v given", err)
+	}
+
+	if got, want := w.Body.String(), `{"type":"ADDED","object":"foo"}`+"\n"; got != want {
+		t.Errorf("got = %s, want %s", got, want)
+	}
+}
+
+func TestHTTP_DoServeHTTP_WatchClientDisconnect(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"kind":"Pod"}}`)
+
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	hp := proxy.NewHTTP(cliFacMock, []proxy.ResponseBodyTransformer{})
+
+	r, err := http.NewRequest(http.MethodGet, "https://api.kube-apiserver-proxy.test/api/v1/pods?watch=true", nil)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	w := &notifyingRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{})}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- hp.DoServeHTTP(ctx, w, *r)
+	}()
+
+	select {
+	case <-w.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first watch event")
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("did not expect an error, %v given", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch stream to be closed")
+	}
+
+	if got, want := strings.TrimSpace(w.body()), `{"type":"ADDED","object":{"kind":"Pod"}}`; got != want {
+		t.Errorf("got = %s, want %s", got, want)
+	}
+}
+
+func TestHTTP_DoServeHTTP_WatchDrain(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"kind":"Pod"}}`)
+
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cliFacMock := kube.NewMockRESTClientFactory(ctrl)
+	cliFacMock.
+		EXPECT().
+		Request(gomock.Any()).
+		Return(rest.NewRequest(c), nil)
+
+	drain := make(chan struct{})
+
+	hp := proxy.NewHTTP(cliFacMock, []proxy.ResponseBodyTransformer{}, proxy.WithDrain(drain))
+
+	r, err := http.NewRequest(http.MethodGet, "https://api.kube-apiserver-proxy.test/api/v1/pods?watch=true", nil)
+	if err != nil {
+		t.Fatalf("cannot create http request: %v", err)
+	}
+
+	w := &notifyingRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{})}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- hp.DoServeHTTP(r.Context(), w, *r)
+	}()
+
+	select {
+	case <-w.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first watch event")
+	}
+
+	close(drain)
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("did not expect an error, %v given", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch stream to be drained")
+	}
+}
+
+type notifyingRecorder struct {
+	*httptest.ResponseRecorder
+
+	mu      sync.Mutex
+	once    sync.Once
+	written chan struct{}
+}
+
+func (nr *notifyingRecorder) Write(b []byte) (int, error) {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	n, err := nr.ResponseRecorder.Write(b)
+
+	nr.once.Do(func() { close(nr.written) })
+
+	return n, err
+}
+
+func (nr *notifyingRecorder) Flush() {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	nr.ResponseRecorder.Flush()
+}
+
+func (nr *notifyingRecorder) body() string {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	return nr.ResponseRecorder.Body.String()
+}
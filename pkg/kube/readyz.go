@@ -0,0 +1,25 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrAPIServerNotReady = errors.New("apiserver is not ready")
+
+// CheckReadyz tells whether the rest config of the factory can be loaded and the apiserver behind it answers
+// its /readyz endpoint successfully. The request is sent with the credentials of the proxy, as there is no
+// caller to impersonate or to take the token from.
+func CheckReadyz(ctx context.Context, f RESTClientFactory) error {
+	c, err := f.Client("", "")
+	if err != nil {
+		return fmt.Errorf("%w: cannot create client: %w", ErrAPIServerNotReady, err)
+	}
+
+	if err := c.Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("%w: %w", ErrAPIServerNotReady, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestCheckReadyz(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc       string
+		statusCode int
+		wantErr    error
+	}{
+		{
+			desc:       "ready",
+			statusCode: http.StatusOK,
+		},
+		{
+			desc:       "not ready",
+			statusCode: http.StatusInternalServerError,
+			wantErr:    kube.ErrAPIServerNotReady,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/readyz" {
+					w.WriteHeader(http.StatusNotFound)
+
+					return
+				}
+
+				w.WriteHeader(tC.statusCode)
+			}))
+			t.Cleanup(srv.Close)
+
+			f := kube.NewDefaultRESTClientFactory(staticRESTConfigFactory{host: srv.URL}, nil, "")
+
+			if err := kube.CheckReadyz(context.Background(), f); !errors.Is(err, tC.wantErr) {
+				t.Errorf("expected error %v, got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckReadyzCannotLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	cf := &countingRESTConfigFactory{}
+	cf.failures.Store(1)
+
+	f := kube.NewDefaultRESTClientFactory(cf, nil, "")
+
+	err := kube.CheckReadyz(context.Background(), f)
+	if !errors.Is(err, kube.ErrAPIServerNotReady) || !errors.Is(err, errFlakyConfig) {
+		t.Errorf("expected a not ready error caused by the config, got %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const (
+	VerbCreate           = "create"
+	VerbDelete           = "delete"
+	VerbDeleteCollection = "deletecollection"
+	VerbGet              = "get"
+	VerbList             = "list"
+	VerbPatch            = "patch"
+	VerbProxy            = "proxy"
+	VerbUpdate           = "update"
+	VerbWatch            = "watch"
+)
+
+// Wildcard matches any verb, api group, resource or name in the patterns of the Match functions.
+const Wildcard = "*"
+
+// RequestInfo holds the information parsed from a request to the apiserver, following
+// the same rules used by the apiserver itself to find out the attributes used for authorization.
+type RequestInfo struct {
+	// IsResourceRequest is false for discovery and non-resource urls such as /version, /healthz or /openapi/v3.
+	IsResourceRequest bool
+	Path              string
+	// Verb is the kubernetes verb for resource requests, and the lowercase http method for the others.
+	Verb        string
+	APIPrefix   string
+	APIGroup    string
+	APIVersion  string
+	Namespace   string
+	Resource    string
+	Subresource string
+	Name        string
+	Parts       []string
+}
+
+type requestInfoKey struct{}
+
+//nolint:gochecknoglobals // constant sets
+var (
+	apiPrefixes                = map[string]struct{}{"api": {}, "apis": {}}
+	legacyAPIPrefixes          = map[string]struct{}{"api": {}}
+	namespaceSubresources      = map[string]struct{}{"status": {}, "finalize": {}}
+	specialVerbs               = map[string]struct{}{VerbProxy: {}, VerbWatch: {}}
+	specialVerbsNoSubresources = map[string]struct{}{VerbProxy: {}}
+)
+
+// ParseRequestInfo returns the information about the request, as the apiserver would parse it.
+//
+// Valid inputs look like:
+//
+//	Resource paths
+//	/apis/{api-group}/{version}/namespaces
+//	/api/{version}/namespaces
+//	/api/{version}/namespaces/{namespace}
+//	/api/{version}/namespaces/{namespace}/{resource}
+//	/api/{version}/namespaces/{namespace}/{resource}/{resourceName}
+//	/api/{version}/{resource}
+//	/api/{version}/{resource}/{resourceName}
+//
+//	Special verbs without subresources:
+//	/api/{version}/proxy/{resource}/{resourceName}
+//	/api/{version}/proxy/namespaces/{namespace}/{resource}/{resourceName}
+//
+//	Special verbs with subresources:
+//	/api/{version}/watch/{resource}
+//	/api/{version}/watch/namespaces/{namespace}/{resource}
+//
+//	NonResource paths
+//	/apis/{api-group}/{version}
+//	/apis/{api-group}
+//	/apis
+//	/api/{version}
+//	/api
+//	/healthz
+//	/
+//
+//nolint:cyclop,funlen,gocognit // mirrors the apiserver implementation
+func ParseRequestInfo(r *http.Request) *RequestInfo {
+	ri := &RequestInfo{
+		IsResourceRequest: false,
+		Path:              r.URL.Path,
+		Verb:              strings.ToLower(r.Method),
+	}
+
+	currentParts := splitPath(r.URL.Path)
+	if len(currentParts) < 3 {
+		// return a non-resource request
+		return ri
+	}
+
+	if _, ok := apiPrefixes[currentParts[0]]; !ok {
+		// return a non-resource request
+		return ri
+	}
+
+	ri.APIPrefix = currentParts[0]
+	currentParts = currentParts[1:]
+
+	if _, ok := legacyAPIPrefixes[ri.APIPrefix]; !ok {
+		// one part (APIPrefix) has already been consumed, so this is actually "do we have four parts?"
+		if len(currentParts) < 3 {
+			// return a non-resource request
+			return ri
+		}
+
+		ri.APIGroup = currentParts[0]
+		currentParts = currentParts[1:]
+	}
+
+	ri.IsResourceRequest = true
+	ri.APIVersion = currentParts[0]
+	currentParts = currentParts[1:]
+
+	// handle input of form /{specialVerb}/*
+	if _, ok := specialVerbs[currentParts[0]]; ok {
+		if len(currentParts) < 2 {
+			return &RequestInfo{
+				IsResourceRequest: false,
+				Path:              r.URL.Path,
+				Verb:              strings.ToLower(r.Method),
+			}
+		}
+
+		ri.Verb = currentParts[0]
+		currentParts = currentParts[1:]
+	} else {
+		switch r.Method {
+		case http.MethodPost:
+			ri.Verb = VerbCreate
+		case http.MethodGet, http.MethodHead:
+			ri.Verb = VerbGet
+		case http.MethodPut:
+			ri.Verb = VerbUpdate
+		case http.MethodPatch:
+			ri.Verb = VerbPatch
+		case http.MethodDelete:
+			ri.Verb = VerbDelete
+		default:
+			ri.Verb = ""
+		}
+	}
+
+	// URL forms: /namespaces/{namespace}/{kind}/*, where parts are adjusted to be relative to kind
+	if currentParts[0] == "namespaces" {
+		if len(currentParts) > 1 {
+			ri.Namespace = currentParts[1]
+
+			// if there is another step after the namespace name and it is not a known namespace subresource
+			// move currentParts to include it as a resource in its own right
+			if _, ok := namespaceSubresources[partAt(currentParts, 2)]; len(currentParts) > 2 && !ok {
+				currentParts = currentParts[2:]
+			}
+		}
+	}
+
+	ri.Parts = currentParts
+
+	// parts look like: resource/resourceName/subresource/other/stuff/we/don't/interpret
+	switch {
+	case len(ri.Parts) >= 3 && !isSpecialVerbNoSubresources(ri.Verb):
+		ri.Subresource = ri.Parts[2]
+
+		fallthrough
+	case len(ri.Parts) >= 2:
+		ri.Name = ri.Parts[1]
+
+		fallthrough
+	case len(ri.Parts) >= 1:
+		ri.Resource = ri.Parts[0]
+	}
+
+	// if there's no name on the request and we thought it was a get before, then the actual verb is a list or a watch
+	if len(ri.Name) == 0 && ri.Verb == VerbGet {
+		ri.Verb = VerbList
+
+		if isWatch(r) {
+			ri.Verb = VerbWatch
+		}
+	}
+
+	// if there's no name on the request and we thought it was a delete before, then the actual verb is deletecollection
+	if len(ri.Name) == 0 && ri.Verb == VerbDelete {
+		ri.Verb = VerbDeleteCollection
+	}
+
+	// lists and watches can be restricted to a single object by using the metadata.name field selector
+	if ri.Verb == VerbList || ri.Verb == VerbWatch {
+		if name, ok := fieldSelectorName(r); ok {
+			ri.Name = name
+		}
+	}
+
+	return ri
+}
+
+// WithRequestInfo returns a copy of the context carrying the given request info.
+func WithRequestInfo(ctx context.Context, ri *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, ri)
+}
+
+// RequestInfoFrom returns the request info stored in the context, if any.
+func RequestInfoFrom(ctx context.Context) (*RequestInfo, bool) {
+	ri, ok := ctx.Value(requestInfoKey{}).(*RequestInfo)
+
+	return ri, ok && ri != nil
+}
+
+// RequestInfoFor returns the request info stored in the context of the request,
+// parsing it when no middleware did it beforehand.
+func RequestInfoFor(r *http.Request) *RequestInfo {
+	if ri, ok := RequestInfoFrom(r.Context()); ok {
+		return ri
+	}
+
+	return ParseRequestInfo(r)
+}
+
+// Matches tells whether the request has one of the given verbs and, when it is a resource request, one of the given
+// api groups and resources, the latter following the rules of MatchesResource. Empty lists match everything, while
+// non-resource requests only match when no api groups nor resources are given.
+func (ri *RequestInfo) Matches(verbs, apiGroups, resources []string) bool {
+	if !MatchesOptional(verbs, ri.Verb) {
+		return false
+	}
+
+	if !ri.IsResourceRequest {
+		return len(apiGroups) == 0 && len(resources) == 0
+	}
+
+	return MatchesOptional(apiGroups, ri.APIGroup) && MatchesResource(resources, ri.Resource, ri.Subresource)
+}
+
+// MatchesOptional is MatchesAny, but it treats an empty list of patterns as a wildcard.
+func MatchesOptional(patterns []string, value string) bool {
+	return len(patterns) == 0 || MatchesAny(patterns, value)
+}
+
+// MatchesAny tells whether the value is equal to one of the patterns, is matched by one of them as a glob,
+// as understood by path.Match, or whether one of the patterns is the "*" wildcard.
+func MatchesAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if p == Wildcard || p == value {
+			return true
+		}
+
+		if m, err := path.Match(p, value); err == nil && m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesResource tells whether the resource and its subresource, if any, are matched by one of the patterns,
+// following the rbac rules: `pods` only matches the pods, `pods/log` their logs, `pods/*` all their subresources,
+// and `*/scale` the scale subresource of any resource. An empty list of patterns matches everything.
+func MatchesResource(patterns []string, resource, subresource string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	combined := resource
+	if subresource != "" {
+		combined = resource + "/" + subresource
+	}
+
+	for _, p := range patterns {
+		switch {
+		case p == Wildcard, p == combined:
+			return true
+
+		case subresource != "" && p == resource+"/"+Wildcard:
+			return true
+
+		case subresource != "" && p == Wildcard+"/"+subresource:
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWatch(r *http.Request) bool {
+	w, err := strconv.ParseBool(r.URL.Query().Get("watch"))
+
+	return err == nil && w
+}
+
+func fieldSelectorName(r *http.Request) (string, bool) {
+	fs := r.URL.Query().Get("fieldSelector")
+	if fs == "" {
+		return "", false
+	}
+
+	selector, err := fields.ParseSelector(fs)
+	if err != nil {
+		return "", false
+	}
+
+	return selector.RequiresExactMatch("metadata.name")
+}
+
+func isSpecialVerbNoSubresources(verb string) bool {
+	_, ok := specialVerbsNoSubresources[verb]
+
+	return ok
+}
+
+func partAt(parts []string, i int) string {
+	if len(parts) > i {
+		return parts[i]
+	}
+
+	return ""
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+
+	return strings.Split(path, "/")
+}
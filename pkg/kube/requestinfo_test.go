@@ -0,0 +1,234 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestParseRequestInfo(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc   string
+		method string
+		url    string
+		want   kube.RequestInfo
+	}{
+		{
+			desc:   "list core resource",
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default/pods",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbList, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "pods",
+			},
+		},
+		{
+			desc:   "get named resource of a group",
+			method: http.MethodGet,
+			url:    "/apis/apps/v1/namespaces/default/deployments/web",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbGet, APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Namespace: "default", Resource: "deployments", Name: "web",
+			},
+		},
+		{
+			desc:   "subresource",
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default/pods/web-0/log",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbGet, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "pods", Subresource: "log", Name: "web-0",
+			},
+		},
+		{
+			desc:   "watch via query parameter",
+			method: http.MethodGet,
+			url:    "/api/v1/pods?watch=true",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbWatch, APIPrefix: "api", APIVersion: "v1", Resource: "pods",
+			},
+		},
+		{
+			desc:   "legacy watch path",
+			method: http.MethodGet,
+			url:    "/api/v1/watch/namespaces/default/pods",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbWatch, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "pods",
+			},
+		},
+		{
+			desc:   "get by field selector on name",
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default/pods?fieldSelector=metadata.name%3Dweb-0",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbList, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "pods", Name: "web-0",
+			},
+		},
+		{
+			desc:   "namespace",
+			method: http.MethodGet,
+			url:    "/api/v1/namespaces/default",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbGet, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "namespaces", Name: "default",
+			},
+		},
+		{
+			desc:   "create",
+			method: http.MethodPost,
+			url:    "/api/v1/namespaces/default/configmaps",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbCreate, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "configmaps",
+			},
+		},
+		{
+			desc:   "delete collection",
+			method: http.MethodDelete,
+			url:    "/api/v1/namespaces/default/configmaps",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbDeleteCollection, APIPrefix: "api", APIVersion: "v1",
+				Namespace: "default", Resource: "configmaps",
+			},
+		},
+		{
+			desc:   "patch",
+			method: http.MethodPatch,
+			url:    "/apis/apps/v1/namespaces/default/deployments/web/scale",
+			want: kube.RequestInfo{
+				IsResourceRequest: true, Verb: kube.VerbPatch, APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Namespace: "default", Resource: "deployments", Subresource: "scale", Name: "web",
+			},
+		},
+		{
+			desc:   "discovery",
+			method: http.MethodGet,
+			url:    "/apis/apps/v1",
+			want:   kube.RequestInfo{Verb: "get", APIPrefix: "apis"},
+		},
+		{
+			desc:   "non-resource url",
+			method: http.MethodGet,
+			url:    "/version",
+			want:   kube.RequestInfo{Verb: "get"},
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got := kube.ParseRequestInfo(httptest.NewRequest(tC.method, tC.url, nil))
+
+			if diff := cmp.Diff(&tC.want, got, cmpopts.IgnoreFields(kube.RequestInfo{}, "Path", "Parts")); diff != "" {
+				t.Errorf("unexpected request info (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRequestInfo_Matches(t *testing.T) {
+	t.Parallel()
+
+	logs := &kube.RequestInfo{
+		IsResourceRequest: true, Verb: kube.VerbGet, APIVersion: "v1",
+		Namespace: "default", Resource: "pods", Subresource: "log", Name: "web-0",
+	}
+	deployments := &kube.RequestInfo{
+		IsResourceRequest: true, Verb: kube.VerbList, APIGroup: "apps", APIVersion: "v1", Resource: "deployments",
+	}
+	version := &kube.RequestInfo{Verb: "get", Path: "/version"}
+
+	testCases := []struct {
+		desc      string
+		ri        *kube.RequestInfo
+		verbs     []string
+		apiGroups []string
+		resources []string
+		want      bool
+	}{
+		{
+			desc: "empty lists",
+			ri:   deployments,
+			want: true,
+		},
+		{
+			desc:      "exact values",
+			ri:        deployments,
+			verbs:     []string{kube.VerbGet, kube.VerbList},
+			apiGroups: []string{"apps"},
+			resources: []string{"deployments"},
+			want:      true,
+		},
+		{
+			desc:  "other verb",
+			ri:    deployments,
+			verbs: []string{kube.VerbGet},
+		},
+		{
+			desc:      "glob api group",
+			ri:        deployments,
+			apiGroups: []string{"app*"},
+			want:      true,
+		},
+		{
+			desc:      "resource without its subresource",
+			ri:        logs,
+			resources: []string{"pods"},
+		},
+		{
+			desc:      "resource with its subresource",
+			ri:        logs,
+			resources: []string{"pods/log"},
+			want:      true,
+		},
+		{
+			desc:      "all the subresources of a resource",
+			ri:        logs,
+			resources: []string{"pods/*"},
+			want:      true,
+		},
+		{
+			desc:      "a subresource of all the resources",
+			ri:        logs,
+			resources: []string{"*/log"},
+			want:      true,
+		},
+		{
+			desc:  "non-resource request",
+			ri:    version,
+			verbs: []string{kube.Wildcard},
+			want:  true,
+		},
+		{
+			desc:      "non-resource request with resources",
+			ri:        version,
+			resources: []string{kube.Wildcard},
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tC.ri.Matches(tC.verbs, tC.apiGroups, tC.resources); got != tC.want {
+				t.Errorf("expected %t, got %t", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WriteStatus renders the given status as the apiserver would, so that clients can rely on a single error format
+// regardless of the failure being generated by the apiserver or by the proxy itself.
+func WriteStatus(w http.ResponseWriter, status metav1.Status) {
+	status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+
+	if status.Status == "" {
+		status.Status = metav1.StatusFailure
+	}
+
+	if status.Code == 0 {
+		status.Code = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(int(status.Code))
+
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,79 @@
+//go:build unit
+
+package kube_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc     string
+		status   metav1.Status
+		wantCode int
+		want     metav1.Status
+	}{
+		{
+			desc:     "bad request",
+			status:   apierrors.NewBadRequest("invalid body").Status(),
+			wantCode: http.StatusBadRequest,
+			want: metav1.Status{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+				Status:   metav1.StatusFailure,
+				Message:  "invalid body",
+				Reason:   metav1.StatusReasonBadRequest,
+				Code:     http.StatusBadRequest,
+			},
+		},
+		{
+			desc:     "empty status",
+			status:   metav1.Status{Message: "boom"},
+			wantCode: http.StatusInternalServerError,
+			want: metav1.Status{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+				Status:   metav1.StatusFailure,
+				Message:  "boom",
+				Code:     http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+
+			kube.WriteStatus(w, tC.status)
+
+			if w.Code != tC.wantCode {
+				t.Errorf("expected status code %d, got %d", tC.wantCode, w.Code)
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("expected content type application/json, got %s", got)
+			}
+
+			var got metav1.Status
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("cannot unmarshal status: %v", err)
+			}
+
+			if diff := cmp.Diff(tC.want, got); diff != "" {
+				t.Errorf("status mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+
+	// Redacted replaces the values that must never end up in the logs.
+	Redacted = "[REDACTED]"
+)
+
+var (
+	ErrUnknownLogLevel  = errors.New("unknown log level")
+	ErrUnknownLogFormat = errors.New("unknown log format")
+
+	// sensitiveKeys are the attribute keys, and the header names, whose values are redacted, compared case-insensitively.
+	// Request and response bodies are among them, as they can carry the data of Secrets.
+	sensitiveKeys = map[string]struct{}{
+		"authorization":       {},
+		"proxy-authorization": {},
+		"cookie":              {},
+		"set-cookie":          {},
+		"x-api-key":           {},
+		"token":               {},
+		"password":            {},
+		"body":                {},
+	}
+)
+
+// New creates a logger writing to w with the given level and format, redacting the sensitive attributes.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownLogLevel, level)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: Redact,
+	}
+
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+
+	case FormatLogfmt:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownLogFormat, format)
+	}
+}
+
+// Redact is a slog.HandlerOptions.ReplaceAttr function that hides the values of the sensitive attributes,
+// and of the sensitive headers when a http.Header is logged.
+func Redact(_ []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	if h, ok := a.Value.Any().(http.Header); ok {
+		return slog.Any(a.Key, RedactHeaders(h))
+	}
+
+	return a
+}
+
+// RedactHeaders returns a copy of the headers with the values of the sensitive ones redacted.
+func RedactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+
+	for k := range out {
+		if IsSensitive(k) {
+			out[k] = []string{Redacted}
+		}
+	}
+
+	return out
+}
+
+func IsSensitive(key string) bool {
+	_, ok := sensitiveKeys[strings.ToLower(key)]
+
+	return ok
+}
@@ -0,0 +1,149 @@
+//go:build unit
+
+package logging_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/logging"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc     string
+		level    string
+		format   string
+		wantErr  error
+		wantLine string
+	}{
+		{
+			desc:     "json",
+			level:    "info",
+			format:   "json",
+			wantLine: `"msg":"hello"`,
+		},
+		{
+			desc:     "logfmt",
+			level:    "debug",
+			format:   "logfmt",
+			wantLine: "msg=hello",
+		},
+		{
+			desc:    "unknown level",
+			level:   "verbose",
+			format:  "json",
+			wantErr: logging.ErrUnknownLogLevel,
+		},
+		{
+			desc:    "unknown format",
+			level:   "info",
+			format:  "xml",
+			wantErr: logging.ErrUnknownLogFormat,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+
+			logger, err := logging.New(&buf, tC.level, tC.format)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			logger.Info("hello")
+
+			if !strings.Contains(buf.String(), tC.wantLine) {
+				t.Errorf("expected %q to contain %q", buf.String(), tC.wantLine)
+			}
+		})
+	}
+}
+
+func TestNewLevel(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&buf, "warn", logging.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("dropped")
+
+	if buf.Len() != 0 {
+		t.Errorf("expected info logs to be dropped, got %q", buf.String())
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer s3cr3t")
+	header.Set("Accept", "application/json")
+
+	logger.Info("request",
+		"body", `{"data":{"password":"aHVudGVyMg=="}}`,
+		"headers", header,
+		"Token", "t0k3n",
+		"path", "/api/v1/secrets",
+	)
+
+	out := buf.String()
+
+	for _, secret := range []string{"s3cr3t", "aHVudGVyMg==", "t0k3n"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted from %q", secret, out)
+		}
+	}
+
+	for _, kept := range []string{"application/json", "/api/v1/secrets", logging.Redacted} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("expected %q to be in %q", kept, out)
+		}
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	header.Set("Cookie", "session=abc")
+	header.Set("X-Request-Id", "42")
+
+	got := logging.RedactHeaders(header)
+
+	if got.Get("Cookie") != logging.Redacted {
+		t.Errorf("expected the cookie to be redacted, got %q", got.Get("Cookie"))
+	}
+
+	if got.Get("X-Request-Id") != "42" {
+		t.Errorf("expected the request id to be kept, got %q", got.Get("X-Request-Id"))
+	}
+
+	if header.Get("Cookie") != "session=abc" {
+		t.Error("expected the original headers to be left untouched")
+	}
+}
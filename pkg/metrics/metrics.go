@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kube_apiserver_proxy"
+
+const (
+	BodyFilterMatched  = "matched"
+	BodyFilterRejected = "rejected"
+	BodyFilterFailed   = "failed"
+
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+
+	RateLimitAllowed = "allowed"
+	RateLimitLimited = "limited"
+
+	// OtherVerb labels the requests whose verb is not a kubernetes one, nor the method of a non-resource request.
+	OtherVerb = "other"
+)
+
+// knownVerbs are the verbs used as labels as they are, so that the clients cannot make up new series
+// by sending requests with arbitrary methods.
+var knownVerbs = map[string]struct{}{
+	"create":           {},
+	"delete":           {},
+	"deletecollection": {},
+	"get":              {},
+	"head":             {},
+	"list":             {},
+	"options":          {},
+	"patch":            {},
+	"post":             {},
+	"proxy":            {},
+	"put":              {},
+	"update":           {},
+	"watch":            {},
+}
+
+type (
+	answeredKey struct{}
+	recorderKey struct{}
+)
+
+// New creates the metrics of the proxy and registers them with the given registerer.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of requests served by the proxy, by verb, group, resource and status code.",
+		}, []string{"verb", "group", "resource", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken by the proxy to serve the requests, by verb, group, resource and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"verb", "group", "resource", "code"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Time taken by the apiserver to answer the proxied requests, by verb, group, resource and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"verb", "group", "resource", "code"}),
+		bodyFilter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "body_filter_requests_total",
+			Help:      "Number of requests whose body went through the body filter, by result.",
+		}, []string{"result"}),
+		transformerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transformer_duration_seconds",
+			Help:      "Time taken by the response body transformers, by transformer.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"transformer"}),
+		transformerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transformer_errors_total",
+			Help:      "Number of response body transformations that failed, by transformer.",
+		}, []string{"transformer"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Number of get and list requests of the cached resources, by group, resource and result.",
+		}, []string{"group", "resource", "result"}),
+		rateLimit: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_requests_total",
+			Help:      "Number of requests matched by a rate limit rule, by rule and result.",
+		}, []string{"rule", "result"}),
+		rateLimiterKeys: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rate_limiter_keys",
+			Help:      "Number of keys currently tracked by the rate limiters, by rule.",
+		}, []string{"rule"}),
+	}
+
+	reg.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.upstreamDuration,
+		m.bodyFilter,
+		m.transformerDuration,
+		m.transformerErrors,
+		m.cacheLookups,
+		m.rateLimit,
+		m.rateLimiterKeys,
+	)
+
+	return m
+}
+
+// Metrics records what the proxy does. All its methods can be called on a nil receiver, in which case they
+// do nothing, so that the components recording metrics do not need to care whether metrics are enabled.
+type Metrics struct {
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	upstreamDuration    *prometheus.HistogramVec
+	bodyFilter          *prometheus.CounterVec
+	transformerDuration *prometheus.HistogramVec
+	transformerErrors   *prometheus.CounterVec
+	cacheLookups        *prometheus.CounterVec
+	rateLimit           *prometheus.CounterVec
+	rateLimiterKeys     *prometheus.GaugeVec
+}
+
+// WithRecorder returns a copy of the context carrying the given metrics, for the downstream components to record to.
+func WithRecorder(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, recorderKey{}, m)
+}
+
+// RecorderFrom returns the metrics stored in the context, or nil if there are none.
+func RecorderFrom(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(recorderKey{}).(*Metrics)
+
+	return m
+}
+
+// WithAnswerTracking returns a copy of the context in which the downstream components record, with MarkAnswered,
+// that the apiserver answered the request, and the function telling whether it did.
+func WithAnswerTracking(ctx context.Context) (context.Context, func() bool) {
+	answered := &atomic.Bool{}
+
+	return context.WithValue(ctx, answeredKey{}, answered), answered.Load
+}
+
+// MarkAnswered records that the apiserver answered the request with the given status code. Only the successful
+// answers are recorded, as the apiserver also answers the requests of resources that do not exist, with a 404.
+func MarkAnswered(ctx context.Context, code int) {
+	if !successful(code) {
+		return
+	}
+
+	if answered, ok := ctx.Value(answeredKey{}).(*atomic.Bool); ok {
+		answered.Store(true)
+	}
+}
+
+// ObserveRequest records a request served by the proxy. The callers must only pass the group and resource
+// of the requests answered by the apiserver, as they are otherwise chosen freely by the clients.
+// The group and resource of the unsuccessful requests are dropped, as they might not exist.
+func (m *Metrics) ObserveRequest(verb, group, resource string, code int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	verb = verbLabel(verb)
+	group, resource = resourceLabels(group, resource, code)
+	c := strconv.Itoa(code)
+
+	m.requests.WithLabelValues(verb, group, resource, c).Inc()
+	m.requestDuration.WithLabelValues(verb, group, resource, c).Observe(d.Seconds())
+}
+
+// ObserveUpstream records the time taken by the apiserver to answer: a zero code means that no answer was received.
+// As for ObserveRequest, the group and resource of the unsuccessful requests are dropped.
+func (m *Metrics) ObserveUpstream(verb, group, resource string, code int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	group, resource = resourceLabels(group, resource, code)
+
+	m.upstreamDuration.WithLabelValues(verbLabel(verb), group, resource, strconv.Itoa(code)).Observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveBodyFilter(result string) {
+	if m == nil {
+		return
+	}
+
+	m.bodyFilter.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) ObserveTransformer(name string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.transformerDuration.WithLabelValues(name).Observe(d.Seconds())
+
+	if err != nil {
+		m.transformerErrors.WithLabelValues(name).Inc()
+	}
+}
+
+// ObserveCacheLookup records whether a request of a cached resource was served from the cache.
+func (m *Metrics) ObserveCacheLookup(group, resource string, hit bool) {
+	if m == nil {
+		return
+	}
+
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+
+	m.cacheLookups.WithLabelValues(group, resource, result).Inc()
+}
+
+// ObserveRateLimit records whether a request matched by the given rate limit rule was let through.
+func (m *Metrics) ObserveRateLimit(rule string, limited bool) {
+	if m == nil {
+		return
+	}
+
+	result := RateLimitAllowed
+	if limited {
+		result = RateLimitLimited
+	}
+
+	m.rateLimit.WithLabelValues(rule, result).Inc()
+}
+
+// SetRateLimiterKeys records the number of keys, such as users or IP addresses, tracked by the given rule.
+func (m *Metrics) SetRateLimiterKeys(rule string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.rateLimiterKeys.WithLabelValues(rule).Set(float64(n))
+}
+
+// RegisterClientCacheSize exposes the number of clients cached by the rest client factories, as returned by size.
+func RegisterClientCacheSize(reg prometheus.Registerer, size func() int) {
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rest_client_cache_size",
+		Help:      "Number of REST clients cached by the proxy.",
+	}, func() float64 {
+		return float64(size())
+	}))
+}
+
+func verbLabel(verb string) string {
+	if _, ok := knownVerbs[verb]; ok {
+		return verb
+	}
+
+	return OtherVerb
+}
+
+// resourceLabels only keeps the group and resource of the successful requests: the apiserver answers the others
+// whatever the group and resource in the url, which the clients could use to make up new series.
+func resourceLabels(group, resource string, code int) (string, string) {
+	if !successful(code) {
+		return "", ""
+	}
+
+	return group, resource
+}
+
+func successful(code int) bool {
+	return code >= http.StatusOK && code < http.StatusMultipleChoices
+}
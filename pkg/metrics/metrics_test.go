@@ -0,0 +1,97 @@
+//go:build unit
+
+package metrics_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	m.ObserveRequest("list", "", "pods", 200, time.Millisecond)
+	m.ObserveRequest("list", "", "pods", 200, time.Millisecond)
+	m.ObserveRequest("get", "apps", "deployments", 404, time.Millisecond)
+	m.ObserveBodyFilter(metrics.BodyFilterMatched)
+	m.ObserveBodyFilter(metrics.BodyFilterRejected)
+	m.ObserveTransformer("jq", time.Millisecond, nil)
+	m.ObserveTransformer("jq", time.Millisecond, errors.New("invalid query"))
+	m.ObserveRateLimit("per-user", false)
+	m.ObserveRateLimit("per-user", true)
+	m.SetRateLimiterKeys("per-user", 2)
+
+	metrics.RegisterClientCacheSize(reg, func() int { return 3 })
+
+	want := `
+# HELP kube_apiserver_proxy_http_requests_total Number of requests served by the proxy, by verb, group, resource and status code.
+# TYPE kube_apiserver_proxy_http_requests_total counter
+kube_apiserver_proxy_http_requests_total{code="200",group="",resource="pods",verb="list"} 2
+kube_apiserver_proxy_http_requests_total{code="404",group="",resource="",verb="get"} 1
+# HELP kube_apiserver_proxy_body_filter_requests_total Number of requests whose body went through the body filter, by result.
+# TYPE kube_apiserver_proxy_body_filter_requests_total counter
+kube_apiserver_proxy_body_filter_requests_total{result="matched"} 1
+kube_apiserver_proxy_body_filter_requests_total{result="rejected"} 1
+# HELP kube_apiserver_proxy_transformer_errors_total Number of response body transformations that failed, by transformer.
+# TYPE kube_apiserver_proxy_transformer_errors_total counter
+kube_apiserver_proxy_transformer_errors_total{transformer="jq"} 1
+# HELP kube_apiserver_proxy_rate_limit_requests_total Number of requests matched by a rate limit rule, by rule and result.
+# TYPE kube_apiserver_proxy_rate_limit_requests_total counter
+kube_apiserver_proxy_rate_limit_requests_total{result="allowed",rule="per-user"} 1
+kube_apiserver_proxy_rate_limit_requests_total{result="limited",rule="per-user"} 1
+# HELP kube_apiserver_proxy_rate_limiter_keys Number of keys currently tracked by the rate limiters, by rule.
+# TYPE kube_apiserver_proxy_rate_limiter_keys gauge
+kube_apiserver_proxy_rate_limiter_keys{rule="per-user"} 2
+# HELP kube_apiserver_proxy_rest_client_cache_size Number of REST clients cached by the proxy.
+# TYPE kube_apiserver_proxy_rest_client_cache_size gauge
+kube_apiserver_proxy_rest_client_cache_size 3
+`
+
+	if err := testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(want),
+		"kube_apiserver_proxy_http_requests_total",
+		"kube_apiserver_proxy_body_filter_requests_total",
+		"kube_apiserver_proxy_transformer_errors_total",
+		"kube_apiserver_proxy_rate_limit_requests_total",
+		"kube_apiserver_proxy_rate_limiter_keys",
+		"kube_apiserver_proxy_rest_client_cache_size",
+	); err != nil {
+		t.Error(err)
+	}
+
+	if got := testutil.CollectAndCount(reg, "kube_apiserver_proxy_http_request_duration_seconds"); got != 2 {
+		t.Errorf("expected 2 latency series, got %d", got)
+	}
+
+	m.ObserveUpstream("get", "made-up.io", "things", 404, time.Millisecond)
+	m.ObserveUpstream("get", "made-up.io", "others", 404, time.Millisecond)
+	m.ObserveUpstream("get", "apps", "deployments", 200, time.Millisecond)
+
+	if got := testutil.CollectAndCount(reg, "kube_apiserver_proxy_upstream_request_duration_seconds"); got != 2 {
+		t.Errorf("expected the unsuccessful upstream requests to share a series, got %d series", got)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	t.Parallel()
+
+	var m *metrics.Metrics
+
+	m.ObserveRequest("list", "", "pods", 200, time.Millisecond)
+	m.ObserveUpstream("list", "", "pods", 200, time.Millisecond)
+	m.ObserveBodyFilter(metrics.BodyFilterMatched)
+	m.ObserveTransformer("jq", time.Millisecond, nil)
+	m.ObserveRateLimit("per-user", true)
+	m.SetRateLimiterKeys("per-user", 1)
+}
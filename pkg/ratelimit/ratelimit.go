@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/time/rate"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	kaspHttp "github.com/omissis/kube-apiserver-proxy/pkg/http"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+)
+
+const (
+	KeyUser   = "user"
+	KeyIP     = "ip"
+	KeyHeader = "header"
+
+	// minIdle is the minimum time a bucket is kept around after its last use, to avoid sweeping too often.
+	minIdle = time.Minute
+)
+
+// Decision is the outcome of the evaluation of the rules against a request.
+type Decision struct {
+	Allowed bool
+	// Rule is the name of the rule that matched the request, empty if none did.
+	Rule string
+	// RetryAfter is the time the caller should wait before retrying a rejected request.
+	RetryAfter time.Duration
+	// Keys is the number of keys tracked by the matching rule.
+	Keys int
+}
+
+// RetryAfterSeconds rounds up the time to wait before retrying, as expected by the Retry-After header.
+func (d Decision) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(d.RetryAfter.Seconds())))
+}
+
+func NewLimiter(rules []config.RateLimitRule) *Limiter {
+	l := &Limiter{
+		rules: make([]*rule, 0, len(rules)),
+	}
+
+	for _, r := range rules {
+		l.rules = append(l.rules, newRule(r))
+	}
+
+	return l
+}
+
+// Limiter applies token bucket rate limits to the requests, keeping a bucket per rule and key.
+type Limiter struct {
+	rules []*rule
+}
+
+// Allow takes a token from the bucket of the first rule matching the request, allowing the requests
+// matching no rule.
+func (l *Limiter) Allow(r *http.Request, id *auth.Identity, ri *kube.RequestInfo) Decision {
+	if id == nil {
+		id = auth.Anonymous()
+	}
+
+	for _, rl := range l.rules {
+		if !rl.matches(ri) {
+			continue
+		}
+
+		wait, keys := rl.take(rl.key(r, id), time.Now())
+
+		return Decision{
+			Allowed:    wait == 0,
+			Rule:       rl.conf.Name,
+			RetryAfter: wait,
+			Keys:       keys,
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+func newRule(conf config.RateLimitRule) *rule {
+	trusted, err := kaspHttp.ParseCIDRs(conf.TrustedProxies)
+	if err != nil {
+		slog.Warn("ignoring trusted proxies of rate limit rule", "rule", conf.Name, "error", err)
+	}
+
+	// A bucket left untouched for burst/qps seconds is full again, so dropping it does not change the outcome.
+	idle := time.Duration(float64(conf.Burst) / conf.QPS * float64(time.Second))
+	if idle < minIdle {
+		idle = minIdle
+	}
+
+	return &rule{
+		conf:    conf,
+		trusted: trusted,
+		idle:    idle,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+type rule struct {
+	conf    config.RateLimitRule
+	trusted []*net.IPNet
+	idle    time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// key returns the bucket key of the request. Header values are hashed, not to keep API keys in memory.
+// Requests without the header share a single bucket.
+func (rl *rule) key(r *http.Request, id *auth.Identity) string {
+	switch rl.conf.Key {
+	case KeyIP:
+		return kaspHttp.ClientIP(r, rl.trusted)
+
+	case KeyHeader:
+		sum := sha256.Sum256([]byte(r.Header.Get(rl.conf.Header)))
+
+		return hex.EncodeToString(sum[:])
+
+	default:
+		return id.Username
+	}
+}
+
+// take consumes a token from the bucket of the key, returning how long to wait for one if none is left,
+// along with the number of tracked keys.
+func (rl *rule) take(key string, now time.Time) (time.Duration, int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(rl.conf.QPS), rl.conf.Burst)}
+		rl.buckets[key] = b
+	}
+
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	if wait := res.DelayFrom(now); wait > 0 {
+		res.CancelAt(now)
+
+		return wait, len(rl.buckets)
+	}
+
+	return 0, len(rl.buckets)
+}
+
+func (rl *rule) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idle {
+		return
+	}
+
+	rl.lastSweep = now
+
+	for k, b := range rl.buckets {
+		if now.Sub(b.lastSeen) >= rl.idle {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+// matches tells whether the rule applies to the request. Verbs, api groups and resources are matched
+// like the ones of the authorization rules: as globs, and following the RBAC conventions for the subresources.
+func (rl *rule) matches(ri *kube.RequestInfo) bool {
+	return ri.Matches(rl.conf.Verbs, rl.conf.APIGroups, rl.conf.Resources)
+}
@@ -0,0 +1,225 @@
+//go:build unit
+
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/auth"
+	"github.com/omissis/kube-apiserver-proxy/pkg/config"
+	"github.com/omissis/kube-apiserver-proxy/pkg/kube"
+	"github.com/omissis/kube-apiserver-proxy/pkg/ratelimit"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Parallel()
+
+	rules := []config.RateLimitRule{
+		{
+			Name:      "api-keys",
+			Key:       ratelimit.KeyHeader,
+			Header:    "X-Api-Key",
+			Verbs:     []string{"list"},
+			Resources: []string{"pods"},
+			QPS:       0.001,
+			Burst:     1,
+		},
+		{
+			Name:           "per-ip",
+			Key:            ratelimit.KeyIP,
+			Resources:      []string{"pods/log"},
+			QPS:            0.001,
+			Burst:          1,
+			TrustedProxies: []string{"10.0.0.0/8"},
+		},
+		{
+			Name:      "per-user",
+			Key:       ratelimit.KeyUser,
+			Resources: []string{"pods"},
+			QPS:       0.001,
+			Burst:     2,
+		},
+	}
+
+	testCases := []struct {
+		desc     string
+		requests []*http.Request
+		ids      []*auth.Identity
+		want     []bool
+		wantRule string
+	}{
+		{
+			desc: "user over its burst",
+			requests: []*http.Request{
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+			},
+			ids:      []*auth.Identity{{Username: "jane"}, {Username: "jane"}, {Username: "jane"}},
+			want:     []bool{true, true, false},
+			wantRule: "per-user",
+		},
+		{
+			desc: "users have their own bucket",
+			requests: []*http.Request{
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0", nil),
+			},
+			ids:      []*auth.Identity{{Username: "john"}, {Username: "john"}, {Username: "mary"}},
+			want:     []bool{true, true, true},
+			wantRule: "per-user",
+		},
+		{
+			desc: "api keys",
+			requests: []*http.Request{
+				newRequest(http.MethodGet, "/api/v1/pods", http.Header{"X-Api-Key": []string{"one"}}),
+				newRequest(http.MethodGet, "/api/v1/pods", http.Header{"X-Api-Key": []string{"two"}}),
+				newRequest(http.MethodGet, "/api/v1/pods", http.Header{"X-Api-Key": []string{"one"}}),
+			},
+			want:     []bool{true, true, false},
+			wantRule: "api-keys",
+		},
+		{
+			desc: "client ip behind a trusted proxy",
+			requests: []*http.Request{
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0/log",
+					http.Header{"X-Forwarded-For": []string{"198.51.100.7"}}),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0/log",
+					http.Header{"X-Forwarded-For": []string{"198.51.100.8"}}),
+				newRequest(http.MethodGet, "/api/v1/namespaces/default/pods/web-0/log",
+					http.Header{"X-Forwarded-For": []string{"198.51.100.7"}}),
+			},
+			want:     []bool{true, true, false},
+			wantRule: "per-ip",
+		},
+		{
+			desc: "no matching rule",
+			requests: []*http.Request{
+				newRequest(http.MethodGet, "/apis/apps/v1/deployments", nil),
+				newRequest(http.MethodGet, "/apis/apps/v1/deployments", nil),
+				newRequest(http.MethodGet, "/apis/apps/v1/deployments", nil),
+			},
+			want: []bool{true, true, true},
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			limiter := ratelimit.NewLimiter(rules)
+
+			for i, req := range tC.requests {
+				var id *auth.Identity
+				if i < len(tC.ids) {
+					id = tC.ids[i]
+				}
+
+				d := limiter.Allow(req, id, kube.RequestInfoFor(req))
+
+				if d.Allowed != tC.want[i] {
+					t.Errorf("request %d: expected allowed to be %t, got %t", i, tC.want[i], d.Allowed)
+				}
+
+				if d.Rule != tC.wantRule {
+					t.Errorf("request %d: expected rule %q, got %q", i, tC.wantRule, d.Rule)
+				}
+
+				if !d.Allowed && d.RetryAfterSeconds() < 1 {
+					t.Errorf("request %d: expected a positive retry after, got %d", i, d.RetryAfterSeconds())
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_AllowMatching(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc   string
+		rule   config.RateLimitRule
+		target string
+		want   bool
+	}{
+		{
+			desc:   "exact api group",
+			rule:   config.RateLimitRule{APIGroups: []string{"apps"}},
+			target: "/apis/apps/v1/deployments",
+			want:   true,
+		},
+		{
+			desc:   "glob api group",
+			rule:   config.RateLimitRule{APIGroups: []string{"*.k8s.io"}},
+			target: "/apis/rbac.authorization.k8s.io/v1/roles",
+			want:   true,
+		},
+		{
+			desc:   "other api group",
+			rule:   config.RateLimitRule{APIGroups: []string{"*.k8s.io"}},
+			target: "/apis/apps/v1/deployments",
+		},
+		{
+			desc:   "resource without its subresources",
+			rule:   config.RateLimitRule{Resources: []string{"pods"}},
+			target: "/api/v1/namespaces/default/pods/web-0/log",
+		},
+		{
+			desc:   "all the subresources of a resource",
+			rule:   config.RateLimitRule{Resources: []string{"pods/*"}},
+			target: "/api/v1/namespaces/default/pods/web-0/log",
+			want:   true,
+		},
+		{
+			desc:   "a subresource of all the resources",
+			rule:   config.RateLimitRule{Resources: []string{"*/log"}},
+			target: "/api/v1/namespaces/default/pods/web-0/log",
+			want:   true,
+		},
+		{
+			desc:   "non-resource request",
+			rule:   config.RateLimitRule{Resources: []string{"*"}},
+			target: "/version",
+		},
+	}
+
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			rule := tC.rule
+			rule.Name = "rule"
+			rule.Key = ratelimit.KeyUser
+			rule.QPS = 1
+			rule.Burst = 1
+
+			req := newRequest(http.MethodGet, tC.target, nil)
+
+			d := ratelimit.NewLimiter([]config.RateLimitRule{rule}).Allow(
+				req, &auth.Identity{Username: "jane"}, kube.RequestInfoFor(req),
+			)
+
+			if got := d.Rule == rule.Name; got != tC.want {
+				t.Errorf("expected the rule to match: %t, got %t", tC.want, got)
+			}
+		})
+	}
+}
+
+func newRequest(method, target string, header http.Header) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+
+	return req
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "kube-apiserver-proxy"
+
+	instrumentationName = "github.com/omissis/kube-apiserver-proxy"
+)
+
+var (
+	ErrCannotCreateExporter = errors.New("cannot create otlp exporter")
+	ErrInvalidEndpoint      = errors.New("invalid otlp endpoint")
+)
+
+// Propagator extracts and injects the W3C trace context from and into the http headers.
+//
+//nolint:gochecknoglobals // stateless propagator
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Tracer returns the tracer of the proxy from the given provider, falling back to a no-op one when nil.
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = trace.NewNoopTracerProvider()
+	}
+
+	return tp.Tracer(instrumentationName)
+}
+
+// NewOTLPTracerProvider returns a provider exporting the spans in batches to the OTLP/HTTP collector at the
+// given endpoint, such as http://otel-collector:4318. Plain http endpoints are reached without TLS.
+func NewOTLPTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidEndpoint, endpoint)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotCreateExporter, err)
+	}
+
+	return NewTracerProvider(sdktrace.WithBatcher(exporter)), nil
+}
+
+// NewTracerProvider returns a provider sampling the spans according to their parent, and all the root ones,
+// so that the proxy honors the sampling decision of its callers.
+func NewTracerProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	}, opts...)
+
+	return sdktrace.NewTracerProvider(opts...)
+}
@@ -0,0 +1,51 @@
+//go:build unit
+
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/omissis/kube-apiserver-proxy/pkg/tracing"
+)
+
+func TestNewOTLPTracerProvider(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc     string
+		endpoint string
+		wantErr  error
+	}{
+		{
+			desc:     "plain http collector",
+			endpoint: "http://otel-collector:4318",
+		},
+		{
+			desc:     "https collector with custom path",
+			endpoint: "https://otel.example.com/otlp/v1/traces",
+		},
+		{
+			desc:     "missing scheme",
+			endpoint: "otel-collector:4318",
+			wantErr:  tracing.ErrInvalidEndpoint,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			tp, err := tracing.NewOTLPTracerProvider(context.Background(), tC.endpoint)
+			if !errors.Is(err, tC.wantErr) {
+				t.Fatalf("expected error %v, got %v", tC.wantErr, err)
+			}
+
+			if tp != nil {
+				_ = tp.Shutdown(context.Background())
+			}
+		})
+	}
+}